@@ -0,0 +1,100 @@
+package pipebuf
+
+import (
+	"io"
+	"sync"
+)
+
+// AsyncWriter is an io.WriteCloser that buffers writes in a pipe and drains
+// them to an underlying writer from a managed background goroutine.
+type AsyncWriter struct {
+	r *PipeReader
+	w *PipeWriter
+
+	mu      sync.Mutex
+	drained sync.Cond
+	written int64 // bytes accepted by Write
+	flushed int64 // bytes handed to dst
+	err     error // first error from dst
+
+	done chan struct{}
+}
+
+var _ io.WriteCloser = (*AsyncWriter)(nil)
+
+// NewAsyncWriter returns an AsyncWriter that buffers up to size bytes and
+// writes them to dst in the background. A write error from dst is returned
+// by the next Write, Flush or Close.
+func NewAsyncWriter(dst io.Writer, size int) *AsyncWriter {
+	r, w := Pipe(size)
+	a := &AsyncWriter{r: r, w: w, done: make(chan struct{})}
+	a.drained.L = &a.mu
+	go a.drain(dst)
+	return a
+}
+
+func (a *AsyncWriter) drain(dst io.Writer) {
+	defer close(a.done)
+	_, err := a.r.p.writeTo(writeFirst(func(p []byte) (int, error) {
+		n, err := dst.Write(p)
+		a.mu.Lock()
+		a.flushed += int64(max(n, 0))
+		a.drained.Broadcast()
+		a.mu.Unlock()
+		return n, err
+	}))
+
+	// Record the error before closing the pipe, so a Write that finds the
+	// pipe closed reports it instead of the ClosedError.
+	a.mu.Lock()
+	a.err = err
+	a.drained.Broadcast()
+	a.mu.Unlock()
+	if err != nil {
+		a.r.CloseWithError(err)
+	}
+}
+
+// Write buffers p for the background goroutine. It blocks only while the
+// buffer is full.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	if err := a.Err(); err != nil {
+		return 0, err
+	}
+	n, err := a.w.Write(p)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.written += int64(n)
+	if err != nil && a.err != nil {
+		err = a.err
+	}
+	return n, err
+}
+
+// Flush waits until everything written before the call has been handed to
+// the underlying writer, and returns its error, if any.
+func (a *AsyncWriter) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	target := a.written
+	for a.flushed < target && a.err == nil {
+		a.drained.Wait()
+	}
+	return a.err
+}
+
+// Err returns the error that stopped the background goroutine, if any.
+func (a *AsyncWriter) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Close flushes the buffered data, stops the background goroutine and
+// returns the first write error from the underlying writer, if any.
+func (a *AsyncWriter) Close() error {
+	a.w.Close()
+	<-a.done
+	return a.Err()
+}
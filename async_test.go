@@ -0,0 +1,103 @@
+package pipebuf_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestAsyncWriter(t *testing.T) {
+	var dst lockedBuffer
+	a := pipebuf.NewAsyncWriter(&dst, 16)
+
+	for i := range 100 {
+		if _, err := fmt.Fprintf(a, "line %d\n", i); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if got := strings.Count(dst.String(), "\n"); got != 100 {
+		t.Fatalf("expected 100 lines after Flush, got %d", got)
+	}
+
+	if _, err := a.Write([]byte("tail\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !strings.HasSuffix(dst.String(), "line 99\ntail\n") {
+		t.Fatalf("expected Close to drain, got %q", dst.String())
+	}
+}
+
+func TestAsyncWriterError(t *testing.T) {
+	dstErr := errors.New("disk full")
+	a := pipebuf.NewAsyncWriter(errWriter{dstErr}, 16)
+
+	if _, err := a.Write([]byte("data")); err != nil {
+		t.Fatalf("first Write failed: %v", err)
+	}
+	expectError(t, a.Flush(), dstErr)
+
+	_, err := a.Write([]byte("more"))
+	expectError(t, err, dstErr)
+	expectError(t, a.Close(), dstErr)
+}
+
+func TestAsyncWriterFlushEmpty(t *testing.T) {
+	var dst lockedBuffer
+	a := pipebuf.NewAsyncWriter(&dst, 16)
+	defer a.Close()
+
+	if err := a.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+}
+
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAsyncWriterWriteAfterError(t *testing.T) {
+	dstErr := errors.New("disk full")
+	for range 100 {
+		a := pipebuf.NewAsyncWriter(errWriter{dstErr}, 1)
+		var err error
+		for err == nil {
+			_, err = a.Write([]byte("data"))
+		}
+		if err != dstErr {
+			t.Fatalf("expected %v, got %v", dstErr, err)
+		}
+		a.Close()
+	}
+}
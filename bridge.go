@@ -0,0 +1,118 @@
+package pipebuf
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// FileBridge connects a pipe to a real OS pipe through a managed pump
+// goroutine, so the pipe can be handed to a child process as exec.Cmd Stdin,
+// Stdout, Stderr or ExtraFiles.
+//
+// Typical use is to set the Cmd field to File, call Cmd.Start, then CloseFile
+// so the child holds the only copy, and finally Wait for the pump.
+type FileBridge struct {
+	file  *os.File // end handed to the child
+	local *os.File // end driven by the pump
+	stop  func()   // closes the pipe side, waking a pump blocked on it
+
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error
+}
+
+// ReaderFile returns a bridge whose File yields the data read from r, for use
+// as a child's standard input. If writing to the child fails, r is closed
+// with that error so the producer sees it; when r reaches EOF or is closed
+// with an error, the child sees end of file.
+func ReaderFile(r *PipeReader) (*FileBridge, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	b := &FileBridge{file: pr, local: pw, done: make(chan struct{})}
+	b.stop = func() { r.CloseWithError(os.ErrClosed) }
+	go func() {
+		defer close(b.done)
+		var writeErr error
+		_, err := r.p.writeTo(writeFirst(func(p []byte) (int, error) {
+			n, err := pw.Write(p)
+			writeErr = err
+			return n, err
+		}))
+		if writeErr != nil {
+			r.CloseWithError(writeErr)
+		}
+		pw.Close()
+		b.err = err
+	}()
+	return b, nil
+}
+
+// WriterFile returns a bridge whose File accepts the data to be written to w,
+// for use as a child's standard output or error. When the child's end is
+// closed, w is closed; a read error closes w with that error. If the reader
+// of w goes away, the child's writes fail.
+func WriterFile(w *PipeWriter) (*FileBridge, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	b := &FileBridge{file: pw, local: pr, done: make(chan struct{})}
+	b.stop = func() { w.CloseWithError(os.ErrClosed) }
+	go func() {
+		defer close(b.done)
+		var readErr error
+		_, err := w.p.readFrom(readFirst(func(p []byte) (int, error) {
+			n, err := pr.Read(p)
+			if err != io.EOF {
+				readErr = err
+			}
+			return n, err
+		}))
+		w.CloseWithError(readErr)
+		pr.Close()
+		b.err = err
+	}()
+	return b, nil
+}
+
+// File returns the end of the OS pipe to hand to the child process.
+func (b *FileBridge) File() *os.File {
+	return b.file
+}
+
+// Done returns a channel that is closed once the pump goroutine has finished.
+func (b *FileBridge) Done() <-chan struct{} {
+	return b.done
+}
+
+// CloseFile closes the parent's copy of File. Call it once the child has
+// started, so that the child exiting is seen as end of file.
+func (b *FileBridge) CloseFile() error {
+	var err error
+	b.closeOnce.Do(func() {
+		err = b.file.Close()
+	})
+	return err
+}
+
+// Wait closes the parent's copy of File, if CloseFile was not called yet, and
+// waits for the pump goroutine to finish. It must be called after the child
+// has been started. It returns the error that stopped the pump, if any other
+// than end of file.
+func (b *FileBridge) Wait() error {
+	b.CloseFile()
+	<-b.done
+	return b.err
+}
+
+// Close stops the bridge without waiting for the child: both ends of the OS
+// pipe are closed, and so is the pipe side with os.ErrClosed, which ends the
+// pump even while it waits for data or space in the pipe.
+func (b *FileBridge) Close() error {
+	b.CloseFile()
+	b.stop()
+	return b.local.Close()
+}
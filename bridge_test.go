@@ -0,0 +1,152 @@
+package pipebuf_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestFileBridge(t *testing.T) {
+	if os.Getenv("PIPEBUF_BRIDGE_CHILD") == "1" {
+		if _, err := io.Copy(os.Stdout, os.Stdin); err != nil {
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+
+	inR, inW := newTestPipe(t, 64)
+	outR, outW := newTestPipe(t, 64)
+
+	stdin, err := pipebuf.ReaderFile(inR)
+	if err != nil {
+		t.Fatalf("ReaderFile failed: %v", err)
+	}
+	stdout, err := pipebuf.WriterFile(outW)
+	if err != nil {
+		t.Fatalf("WriterFile failed: %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFileBridge$")
+	cmd.Env = append(os.Environ(), "PIPEBUF_BRIDGE_CHILD=1")
+	cmd.Stdin = stdin.File()
+	cmd.Stdout = stdout.File()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	stdin.CloseFile()
+	stdout.CloseFile()
+
+	testData := bytes.Repeat([]byte("through the child\n"), 1000)
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer inW.Close()
+		mustWrite(t, inW, testData)
+	})
+
+	got, err := io.ReadAll(outR)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	wg.Wait()
+
+	if err := stdin.Wait(); err != nil {
+		t.Fatalf("stdin bridge failed: %v", err)
+	}
+	if err := stdout.Wait(); err != nil {
+		t.Fatalf("stdout bridge failed: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child failed: %v", err)
+	}
+	if !bytes.Equal(got, testData) {
+		t.Fatalf("data integrity check failed")
+	}
+}
+
+func TestFileBridgeChildClosesOutput(t *testing.T) {
+	_, w := newTestPipe(t, 64)
+
+	b, err := pipebuf.WriterFile(w)
+	if err != nil {
+		t.Fatalf("WriterFile failed: %v", err)
+	}
+	f := b.File()
+	if _, err := f.Write([]byte("data")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := b.Wait(); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	_, err = w.Write([]byte("x"))
+	expectError(t, err, io.ErrClosedPipe)
+}
+
+func TestFileBridgeChildGone(t *testing.T) {
+	r, w := newTestPipe(t, 64)
+
+	b, err := pipebuf.ReaderFile(r)
+	if err != nil {
+		t.Fatalf("ReaderFile failed: %v", err)
+	}
+	b.File().Close() // the child exits without reading
+
+	var writeErr error
+	for range 100 {
+		if _, writeErr = w.Write([]byte("data")); writeErr != nil {
+			break
+		}
+	}
+	if writeErr == nil {
+		t.Fatal("expected the producer to see the child's end closing")
+	}
+	if !errors.Is(writeErr, io.ErrClosedPipe) {
+		t.Fatalf("expected ClosedError, got %v", writeErr)
+	}
+	if err := b.Wait(); err == nil {
+		t.Fatal("expected the bridge to report the write error")
+	}
+}
+
+func TestFileBridgeClose(t *testing.T) {
+	t.Run("ReaderFile", func(t *testing.T) {
+		r, w := newTestPipe(t, 64)
+
+		b, err := pipebuf.ReaderFile(r)
+		if err != nil {
+			t.Fatalf("ReaderFile failed: %v", err)
+		}
+		// The pump is waiting for the producer, which never writes.
+		b.Close()
+		<-b.Done()
+
+		_, err = w.Write([]byte("x"))
+		expectError(t, err, os.ErrClosed)
+	})
+
+	t.Run("WriterFile", func(t *testing.T) {
+		r, w := newTestPipe(t, 1)
+
+		b, err := pipebuf.WriterFile(w)
+		if err != nil {
+			t.Fatalf("WriterFile failed: %v", err)
+		}
+		// Fill the pipe so the pump waits for space.
+		if _, err := b.File().Write([]byte("ab")); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		<-r.Readable()
+		b.Close()
+		<-b.Done()
+
+		_, err = io.ReadAll(r)
+		expectError(t, err, os.ErrClosed)
+	})
+}
@@ -0,0 +1,156 @@
+package pipebuf
+
+import "sync"
+
+// Budget caps the memory that a set of pipes grows into. Pipes created with
+// WithBudget start with a small buffer and grow towards their full size only
+// while the budget has room. A drained pipe keeps its growth until its writer
+// or reader is closed, or until another pipe needs the room; it is safe for
+// concurrent use.
+type Budget struct {
+	mu    sync.Mutex
+	total int64
+	used  int64
+
+	// idle holds the pipes that drained while holding growth, which can
+	// give it back when another pipe runs short.
+	idle map[reclaimer]struct{}
+}
+
+// reclaimer is a pipe that can give its growth back to the budget.
+type reclaimer interface {
+	// reclaim shrinks the pipe if it is still drained and not busy, and
+	// reports whether it did.
+	reclaim() bool
+}
+
+// NewBudget returns a budget of totalBytes shared by the pipes it is passed to.
+func NewBudget(totalBytes int64) *Budget {
+	return &Budget{total: max(totalBytes, 0), idle: make(map[reclaimer]struct{})}
+}
+
+// Total returns the size of the budget.
+func (b *Budget) Total() int64 {
+	return b.total
+}
+
+// Used returns the number of bytes currently drawn by pipes.
+func (b *Budget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// take draws up to n bytes from the budget and returns how many were granted.
+func (b *Budget) take(n int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n = int(min(int64(n), b.total-b.used))
+	if n <= 0 {
+		return 0
+	}
+	b.used += int64(n)
+	return n
+}
+
+// release returns the n bytes drawn by r.
+func (b *Budget) release(r reclaimer, n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= int64(n)
+	delete(b.idle, r)
+}
+
+// setIdle records that r has drained while holding growth.
+func (b *Budget) setIdle(r reclaimer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.idle[r] = struct{}{}
+}
+
+// reclaim asks the idle pipes other than except to give their growth back,
+// and reports whether any did. The budget lock is not held while they shrink,
+// and pipes that are busy are skipped, so a pipe may call it with its own
+// lock held.
+func (b *Budget) reclaim(except reclaimer) bool {
+	b.mu.Lock()
+	idle := make([]reclaimer, 0, len(b.idle))
+	for r := range b.idle {
+		if r != except {
+			idle = append(idle, r)
+		}
+	}
+	b.mu.Unlock()
+
+	reclaimed := false
+	for _, r := range idle {
+		if r.reclaim() {
+			reclaimed = true
+		}
+	}
+	return reclaimed
+}
+
+// growLocked tries to enlarge the buffer of a budgeted pipe so that need
+// elements fit, aiming for room for want, up to the size the pipe was created
+// with. It reports whether the buffer grew.
+func (p *pipe[T]) growLocked(need, want int) bool {
+	size := p.buffer.size
+	if p.budget == nil || size >= p.maxSize {
+		return false
+	}
+	delta := min(p.buffer.len()+max(need, want), p.maxSize) - size
+	granted := p.budget.take(delta)
+	if granted < delta && p.budget.reclaim(p) {
+		granted += p.budget.take(delta - granted)
+	}
+	if granted == 0 {
+		return false
+	}
+	p.charged += granted
+	p.buffer.resize(size + granted)
+	return true
+}
+
+// drainedLocked is called when the reader has emptied the buffer. Growth is
+// kept for the next burst, unless the writer is closed and no more will come;
+// otherwise the budget may reclaim it when another pipe runs short.
+func (p *pipe[T]) drainedLocked() {
+	if p.budget == nil || p.charged == 0 {
+		return
+	}
+	// A writer holding its turn may be filling reserved space in the
+	// current buffer, so only shrink while none is.
+	if p.writerClosed && !p.writerTurn.busy {
+		p.shrinkLocked()
+		return
+	}
+	if !p.idle {
+		p.idle = true
+		p.budget.setIdle(p)
+	}
+}
+
+func (p *pipe[T]) reclaim() bool {
+	if !p.mu.TryLock() {
+		return false
+	}
+	defer p.mu.Unlock()
+	if !p.buffer.empty() || p.writerTurn.busy {
+		return false
+	}
+	return p.shrinkLocked()
+}
+
+// shrinkLocked returns an emptied buffer to its minimum size and gives the
+// growth back to the budget. It reports whether there was growth to return.
+func (p *pipe[T]) shrinkLocked() bool {
+	if p.budget == nil || p.charged == 0 {
+		return false
+	}
+	p.buffer.resize(p.minSize)
+	p.budget.release(p, p.charged)
+	p.charged = 0
+	p.idle = false
+	return true
+}
@@ -0,0 +1,134 @@
+package pipebuf_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestBudgetGrowth(t *testing.T) {
+	b := pipebuf.NewBudget(16)
+	r1, w1 := pipebuf.Pipe(64, pipebuf.WithBudget(b, 4))
+
+	// The pipe grows from 4 bytes straight to the 10 it needs.
+	mustWrite(t, w1, []byte("0123456789"))
+	if used := b.Used(); used != 6 {
+		t.Fatalf("expected 6 bytes used, got %d", used)
+	}
+
+	// The second pipe gets the remaining 10 bytes on top of its minimum,
+	// then waits for its reader.
+	r2, w2 := pipebuf.Pipe(64, pipebuf.WithBudget(b, 4))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mustWrite(t, w2, []byte("abcdefghijklmnopqrst"))
+	}()
+	time.Sleep(10 * time.Millisecond)
+	expectPending(t, done)
+	if used := b.Used(); used != 16 {
+		t.Fatalf("expected 16 bytes used, got %d", used)
+	}
+	mustRead(t, r2, []byte("abcdefghijklmn"))
+	<-done
+	mustRead(t, r2, []byte("opqrst"))
+
+	// Drained pipes keep their growth for the next burst...
+	mustRead(t, r1, []byte("0123456789"))
+	if used := b.Used(); used != 16 {
+		t.Fatalf("expected 16 bytes used, got %d", used)
+	}
+
+	// ...until another pipe runs short.
+	r3, w3 := pipebuf.Pipe(64, pipebuf.WithBudget(b, 4))
+	mustWrite(t, w3, []byte("ABCDEFGH"))
+	if used := b.Used(); used != 4 {
+		t.Fatalf("expected 4 bytes used, got %d", used)
+	}
+
+	// Draining a pipe whose writer is closed gives the growth back.
+	w3.Close()
+	mustRead(t, r3, []byte("ABCDEFGH"))
+	if used := b.Used(); used != 0 {
+		t.Fatalf("expected 0 bytes used, got %d", used)
+	}
+
+	// So does closing the reader with data still buffered.
+	mustWrite(t, w1, []byte("0123456789"))
+	r1.Close()
+	if used := b.Used(); used != 0 {
+		t.Fatalf("expected 0 bytes used, got %d", used)
+	}
+}
+
+func TestBudgetSteadyStateDoesNotAllocate(t *testing.T) {
+	r, w := pipebuf.Pipe(64<<10, pipebuf.WithBudget(pipebuf.NewBudget(1<<30), 256))
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+
+	data := make([]byte, 4<<10)
+	buf := make([]byte, 4<<10)
+	cycle := func() {
+		mustWrite(t, w, data)
+		mustReadFull(t, r, buf)
+	}
+	cycle() // grows once
+	if allocs := testing.AllocsPerRun(100, cycle); allocs != 0 {
+		t.Fatalf("expected no allocations per cycle, got %v", allocs)
+	}
+}
+
+func TestBudgetReleasedAtEOF(t *testing.T) {
+	b := pipebuf.NewBudget(1 << 20)
+	r, w := pipebuf.Pipe(1<<16, pipebuf.WithBudget(b, 16))
+
+	mustWrite(t, w, make([]byte, 1<<16))
+	w.Close()
+	if used := b.Used(); used != 1<<16-16 {
+		t.Fatalf("expected %d bytes used, got %d", 1<<16-16, used)
+	}
+
+	// The reader drains to EOF without calling Close.
+	got, err := io.ReadAll(r)
+	if err != nil || len(got) != 1<<16 {
+		t.Fatalf("expected %d bytes, got %d, %v", 1<<16, len(got), err)
+	}
+	if used := b.Used(); used != 0 {
+		t.Fatalf("expected 0 bytes used, got %d", used)
+	}
+}
+
+func TestBudgetGrowthKeepsData(t *testing.T) {
+	b := pipebuf.NewBudget(64)
+	r, w := pipebuf.Pipe(16, pipebuf.WithBudget(b, 4), pipebuf.WithHistory(2))
+
+	mustWrite(t, w, []byte("abc"))
+	mustRead(t, r, []byte("ab"))
+	// Wraps around the minimum buffer, then grows.
+	mustWrite(t, w, []byte("defghij"))
+	mustRead(t, r, []byte("cdefghij"))
+
+	if err := r.Rewind(2); err != nil {
+		t.Fatal(err)
+	}
+	mustRead(t, r, []byte("ij"))
+
+	// Growth stops at the buffer size.
+	mustWrite(t, w, make([]byte, 16))
+	if used := b.Used(); used != 12 {
+		t.Fatalf("expected 12 bytes used, got %d", used)
+	}
+}
+
+func TestBudgetAtomicWrites(t *testing.T) {
+	b := pipebuf.NewBudget(0)
+	r, w := pipebuf.Pipe(16, pipebuf.WithBudget(b, 1), pipebuf.WithAtomicWrites(8))
+
+	// The minimum is raised so an atomic write always fits.
+	mustWrite(t, w, []byte("12345678"))
+	mustRead(t, r, []byte("12345678"))
+}
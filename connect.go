@@ -0,0 +1,116 @@
+package pipebuf
+
+import "io"
+
+// Link is a copy running in a managed goroutine, started by Connect.
+type Link struct {
+	done chan struct{}
+	err  error
+}
+
+// Connect copies from src to dst in a background goroutine until src is
+// exhausted or either side fails, propagating the outcome to the pipes
+// involved: when dst is a PipeWriter it is closed once src reaches EOF, or
+// closed with src's read error; when src is a PipeReader and writing to dst
+// fails, it is closed with that write error so its writer stops as well.
+func Connect(src io.Reader, dst io.Writer) *Link {
+	l := &Link{done: make(chan struct{})}
+	go l.run(src, dst)
+	return l
+}
+
+func (l *Link) run(src io.Reader, dst io.Writer) {
+	defer close(l.done)
+
+	var readErr, writeErr error
+	read := readerFunc(func(p []byte) (int, error) {
+		n, err := src.Read(p)
+		if err != nil && err != io.EOF {
+			readErr = err
+		}
+		return n, err
+	})
+	write := writerFunc(func(p []byte) (int, error) {
+		n, err := dst.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		writeErr = err
+		return n, err
+	})
+
+	srcPipe, _ := src.(*PipeReader)
+	dstPipe, _ := dst.(*PipeWriter)
+
+	var (
+		err      error
+		upstream bool
+	)
+	switch {
+	case srcPipe != nil && dstPipe != nil:
+		// Hand dst to WriteTo as is, so data moves directly between the
+		// two buffers.
+		_, err = srcPipe.WriteTo(dstPipe)
+		upstream = srcPipe.p.readFailed(err)
+	case srcPipe != nil:
+		_, err = srcPipe.WriteTo(write)
+		upstream = writeErr == nil
+	case dstPipe != nil:
+		_, err = dstPipe.ReadFrom(read)
+		upstream = readErr != nil
+	default:
+		_, err = io.Copy(write, read)
+		upstream = readErr != nil
+	}
+
+	if err == nil {
+		if dstPipe != nil {
+			dstPipe.Close()
+		}
+		return
+	}
+	l.err = err
+	if upstream && dstPipe != nil {
+		dstPipe.CloseWithError(err)
+	}
+	if !upstream && srcPipe != nil {
+		srcPipe.CloseWithError(err)
+	}
+}
+
+// Done returns a channel that is closed when the copy has finished.
+func (l *Link) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns the error that stopped the copy, or nil if it reached EOF.
+// It returns nil while the copy is still running.
+func (l *Link) Err() error {
+	select {
+	case <-l.done:
+		return l.err
+	default:
+		return nil
+	}
+}
+
+// readFailed reports whether err, returned while reading from the pipe, came
+// from the pipe itself: its reader was closed, or its writer was closed with
+// err as the cause.
+func (p *pipe[T]) readFailed(err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.readerClosed || (p.writerClosed && err == p.readerClosedErr)
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,108 @@
+package pipebuf_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestConnect(t *testing.T) {
+	r, w := newTestPipe(t, 16)
+
+	input := strings.Repeat("connected ", 100)
+	l := pipebuf.Connect(strings.NewReader(input), w)
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	waitLink(t, l)
+	if l.Err() != nil {
+		t.Fatalf("expected nil Err, got %v", l.Err())
+	}
+	if string(got) != input {
+		t.Fatalf("data mismatch: got %d bytes", len(got))
+	}
+}
+
+func TestConnectDownstreamFailure(t *testing.T) {
+	r, w := newTestPipe(t, 16)
+
+	writeErr := errors.New("upload failed")
+	l := pipebuf.Connect(r, errWriter{writeErr})
+
+	// The producer is unblocked by the downstream failure instead of hanging.
+	_, err := w.Write(bytes.Repeat([]byte("x"), 1024))
+	expectError(t, err, writeErr)
+
+	waitLink(t, l)
+	expectError(t, l.Err(), writeErr)
+}
+
+func TestConnectUpstreamFailure(t *testing.T) {
+	r, w := newTestPipe(t, 16)
+
+	readErr := errors.New("source failed")
+	l := pipebuf.Connect(io.MultiReader(strings.NewReader("data"), &failingReader{err: readErr}), w)
+
+	got, err := io.ReadAll(r)
+	expectError(t, err, readErr)
+	if string(got) != "data" {
+		t.Fatalf("expected %q, got %q", "data", got)
+	}
+
+	waitLink(t, l)
+	expectError(t, l.Err(), readErr)
+}
+
+func TestConnectPipeToPipe(t *testing.T) {
+	r1, w1 := newTestPipe(t, 16)
+	r2, w2 := newTestPipe(t, 16)
+
+	l := pipebuf.Connect(r1, w2)
+
+	causeErr := errors.New("producer failed")
+	mustWrite(t, w1, []byte("partial"))
+	w1.CloseWithError(causeErr)
+
+	got, err := io.ReadAll(r2)
+	expectError(t, err, causeErr)
+	if string(got) != "partial" {
+		t.Fatalf("expected %q, got %q", "partial", got)
+	}
+	waitLink(t, l)
+	expectError(t, l.Err(), causeErr)
+}
+
+func TestConnectPipeToPipeDownstreamFailure(t *testing.T) {
+	r1, w1 := newTestPipe(t, 16)
+	r2, w2 := newTestPipe(t, 16)
+
+	l := pipebuf.Connect(r1, w2)
+
+	consumerErr := errors.New("consumer failed")
+	r2.CloseWithError(consumerErr)
+
+	// The producer sees the consumer's failure through the link.
+	var err error
+	for err == nil {
+		_, err = w1.Write([]byte("data"))
+	}
+	expectError(t, err, consumerErr)
+	waitLink(t, l)
+	expectError(t, l.Err(), consumerErr)
+}
+
+func waitLink(t *testing.T, l *pipebuf.Link) {
+	t.Helper()
+	select {
+	case <-l.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for link")
+	}
+}
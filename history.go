@@ -0,0 +1,157 @@
+package pipebuf
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// ErrRewind is returned when rewinding past the bytes retained by WithHistory.
+	ErrRewind = errors.New("pipebuf: rewind beyond retained history")
+
+	// ErrOutOfWindow is returned by ReadAt for offsets that are no longer
+	// retained, or not yet written.
+	ErrOutOfWindow = errors.New("pipebuf: offset outside the retained window")
+)
+
+var _ io.ReaderAt = (*PipeReader)(nil)
+
+// Mark records the current read position for a later RewindToMark.
+// Until Mark is called, the mark is the start of the stream.
+func (r *PipeReader) Mark() {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	r.p.waitReaderTurnLocked()
+	defer r.p.doneReaderTurnLocked()
+	r.p.mark = r.p.buffer.readOff
+}
+
+// RewindToMark moves the read position back to the last Mark, so the bytes
+// read since then are returned again. It fails with ErrRewind if more than
+// the WithHistory window has been read since the mark.
+//
+// See RetryableBody for replaying an HTTP request body.
+func (r *PipeReader) RewindToMark() error {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	r.p.waitReaderTurnLocked()
+	defer r.p.doneReaderTurnLocked()
+	if r.p.mark > r.p.buffer.readOff {
+		return ErrRewind
+	}
+	return r.p.rewindLocked(int(r.p.buffer.readOff - r.p.mark))
+}
+
+// Rewind moves the read position back by n bytes, so they are returned again
+// by the next reads. It fails with ErrRewind if fewer than n consumed bytes
+// are retained.
+func (r *PipeReader) Rewind(n int) error {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	r.p.waitReaderTurnLocked()
+	defer r.p.doneReaderTurnLocked()
+	return r.p.rewindLocked(n)
+}
+
+// RetryableBody marks the current read position and returns a request body
+// reading from r, together with a function to set as Request.GetBody. Each
+// call to getBody rewinds r to the mark and returns a fresh body, so a
+// streaming body can be resent on a redirect or retry as long as no more than
+// the WithHistory window has been read since the mark.
+//
+// Closing a body only stops reads through it; net/http closes every body it
+// is done with, so the pipe itself is left open. Close r once the request has
+// completed.
+func (r *PipeReader) RetryableBody() (body io.ReadCloser, getBody func() (io.ReadCloser, error)) {
+	r.Mark()
+	getBody = func() (io.ReadCloser, error) {
+		if err := r.RewindToMark(); err != nil {
+			return nil, err
+		}
+		return &retryBody{p: r.p}, nil
+	}
+	return &retryBody{p: r.p}, getBody
+}
+
+// retryBody reads from a pipe until it is closed, leaving the pipe open.
+type retryBody struct {
+	p      *pipe[byte]
+	closed bool // guarded by p.mu
+}
+
+func (b *retryBody) Read(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	p := b.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitReaderTurnLocked()
+	defer p.doneReaderTurnLocked()
+	// Checked within the turn, so a body closed before a rewind can't
+	// consume the replayed bytes meant for its successor.
+	if b.closed {
+		return 0, closedError(nil, false)
+	}
+	return p.readLocked(buf)
+}
+
+func (b *retryBody) Close() error {
+	b.p.mu.Lock()
+	defer b.p.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+func (p *pipe[T]) rewindLocked(n int) error {
+	if p.readerClosed {
+		return closedError(p.writerClosedErr, false)
+	}
+	wasEmpty := p.buffer.empty()
+	if !p.buffer.rewind(n) {
+		return ErrRewind
+	}
+	if wasEmpty && !p.buffer.empty() {
+		p.wakeReaderLocked()
+	}
+	return nil
+}
+
+// Offset returns the stream offset of the next byte Read will return,
+// counted from the first byte ever written to the pipe.
+func (r *PipeReader) Offset() int64 {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	return int64(r.p.buffer.readOff)
+}
+
+// ReadAt implements io.ReaderAt over the bytes still held by the pipe: the
+// history kept by WithHistory and the unread data, addressed by absolute
+// stream offset. It does not consume data or move the read position, and it
+// never blocks. Offsets that have fallen out of the history, or that are
+// beyond the data written so far, yield ErrOutOfWindow; once the writer is
+// closed, reading past the end of the stream yields io.EOF.
+func (r *PipeReader) ReadAt(b []byte, off int64) (int, error) {
+	p := r.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.readerClosed {
+		return 0, closedError(p.writerClosedErr, false)
+	}
+	if off < 0 || uint64(off) < p.buffer.histOff {
+		return 0, ErrOutOfWindow
+	}
+
+	end := p.buffer.writeOff
+	avail := int(min(uint64(len(b)), end-min(uint64(off), end)))
+	first, second := p.buffer.segments(uint64(off), avail)
+	n := copy(b, first)
+	n += copy(b[n:], second)
+	if n < len(b) {
+		if p.writerClosed {
+			return n, io.EOF
+		}
+		return n, ErrOutOfWindow
+	}
+	return n, nil
+}
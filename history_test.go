@@ -0,0 +1,198 @@
+package pipebuf_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestRewind(t *testing.T) {
+	r, w := pipebuf.Pipe(4, pipebuf.WithHistory(4))
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+
+	mustWrite(t, w, []byte("abcd"))
+	mustRead(t, r, []byte("abc"))
+
+	if err := r.Rewind(2); err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	mustRead(t, r, []byte("bcd"))
+
+	// The history does not take space from the writer.
+	mustWrite(t, w, []byte("efgh"))
+	mustRead(t, r, []byte("efgh"))
+
+	expectError(t, r.Rewind(5), pipebuf.ErrRewind)
+	if err := r.Rewind(4); err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	mustRead(t, r, []byte("efgh"))
+}
+
+func TestRewindToMark(t *testing.T) {
+	r, w := pipebuf.Pipe(8, pipebuf.WithHistory(4))
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+
+	mustWrite(t, w, []byte("headbody"))
+	mustRead(t, r, []byte("head"))
+	r.Mark()
+	mustRead(t, r, []byte("bo"))
+
+	if err := r.RewindToMark(); err != nil {
+		t.Fatalf("RewindToMark failed: %v", err)
+	}
+	mustRead(t, r, []byte("body"))
+
+	mustWrite(t, w, []byte("tail"))
+	mustRead(t, r, []byte("tail"))
+	expectError(t, r.RewindToMark(), pipebuf.ErrRewind)
+}
+
+func TestRewindWithoutHistory(t *testing.T) {
+	r, w := newTestPipe(t, 4)
+
+	mustWrite(t, w, []byte("ab"))
+	mustRead(t, r, []byte("ab"))
+	expectError(t, r.Rewind(1), pipebuf.ErrRewind)
+}
+
+func TestRetryableBodyFollowsRedirect(t *testing.T) {
+	body := strings.Repeat("streamed body ", 64)
+
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(rw http.ResponseWriter, req *http.Request) {
+		io.ReadAll(req.Body)
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		http.Redirect(rw, req, "/final", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/final", func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		got, _ := io.ReadAll(req.Body)
+		rw.Write(got)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	r, w := pipebuf.Pipe(64, pipebuf.WithHistory(len(body)))
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+	go func() {
+		defer w.Close()
+		mustWrite(t, w, []byte(body))
+	}()
+
+	reqBody, getBody := r.RetryableBody()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/redirect", reqBody)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.GetBody = getBody
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(got) != body {
+		t.Fatalf("expected the full body to be resent, got %d %q", resp.StatusCode, got)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 requests, got %d", attempts)
+	}
+}
+
+func TestRetryableBodyClose(t *testing.T) {
+	r, w := pipebuf.Pipe(8, pipebuf.WithHistory(8))
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+
+	body, getBody := r.RetryableBody()
+	mustWrite(t, w, []byte("abcd"))
+	mustRead(t, body, []byte("ab"))
+	body.Close()
+
+	_, err := body.Read(make([]byte, 1))
+	expectError(t, err, io.ErrClosedPipe)
+
+	// Closing the body left the pipe open.
+	mustWrite(t, w, []byte("ef"))
+	body, err = getBody()
+	if err != nil {
+		t.Fatalf("getBody failed: %v", err)
+	}
+	mustRead(t, body, []byte("abcdef"))
+}
+
+func TestReadAt(t *testing.T) {
+	r, w := pipebuf.Pipe(4, pipebuf.WithHistory(6))
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+
+	mustWrite(t, w, []byte("abcd"))
+	mustRead(t, r, []byte("abcd"))
+	mustWrite(t, w, []byte("efgh"))
+	mustRead(t, r, []byte("ef"))
+
+	if off := r.Offset(); off != 6 {
+		t.Fatalf("expected offset 6, got %d", off)
+	}
+
+	buf := make([]byte, 4)
+	n, err := r.ReadAt(buf, 1)
+	if err != nil || string(buf[:n]) != "bcde" {
+		t.Fatalf("expected %q, got %q, %v", "bcde", buf[:n], err)
+	}
+
+	// Reading ahead of the read position does not consume.
+	n, err = r.ReadAt(buf[:2], 6)
+	if err != nil || string(buf[:n]) != "gh" {
+		t.Fatalf("expected %q, got %q, %v", "gh", buf[:n], err)
+	}
+	mustRead(t, r, []byte("gh"))
+
+	// "a" and "b" fell out of the six byte history.
+	_, err = r.ReadAt(buf, 1)
+	expectError(t, err, pipebuf.ErrOutOfWindow)
+
+	n, err = r.ReadAt(buf, 6)
+	expectError(t, err, pipebuf.ErrOutOfWindow)
+	if n != 2 {
+		t.Fatalf("expected 2 bytes before the end of the data, got %d", n)
+	}
+
+	w.Close()
+	n, err = r.ReadAt(buf, 6)
+	expectError(t, err, io.EOF)
+	if n != 2 || string(buf[:n]) != "gh" {
+		t.Fatalf("expected %q, got %q", "gh", buf[:n])
+	}
+}
@@ -0,0 +1,95 @@
+package pipebuf
+
+import (
+	"context"
+	"reflect"
+)
+
+// closedChan is returned by the notification methods when the awaited
+// state already holds.
+var closedChan = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// waitChanLocked returns a channel that is closed by wakeChanLocked(ch),
+// or closedChan when ready is true. The channel is created on demand so
+// pipes that are never polled do not allocate.
+func waitChanLocked(ch *chan struct{}, ready bool) <-chan struct{} {
+	if ready {
+		return closedChan
+	}
+	if *ch == nil {
+		*ch = make(chan struct{})
+	}
+	return *ch
+}
+
+// wakeChanLocked closes the channel handed out by waitChanLocked, if any.
+func wakeChanLocked(ch *chan struct{}) {
+	if *ch != nil {
+		close(*ch)
+		*ch = nil
+	}
+}
+
+func (p *pipe[T]) wakeAllLocked() {
+	wakeChanLocked(&p.readable)
+	wakeChanLocked(&p.writable)
+	wakeChanLocked(&p.closed)
+}
+
+func (p *pipe[T]) closedChan() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return waitChanLocked(&p.closed, p.readerClosed || p.writerClosed)
+}
+
+// Readable returns a channel that is closed when a Read would not block:
+// data is buffered or either side of the pipe has been closed.
+// The channel fires once; call Readable again after each wake-up.
+func (r *PipeReader) Readable() <-chan struct{} {
+	p := r.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return waitChanLocked(&p.readable, !p.buffer.empty() || p.readerClosed || p.writerClosed)
+}
+
+// Closed returns a channel that is closed once either side of the pipe is closed.
+func (r *PipeReader) Closed() <-chan struct{} {
+	return r.p.closedChan()
+}
+
+// Writable returns a channel that is closed when a Write would not block:
+// the buffer has free space or either side of the pipe has been closed.
+// The channel fires once; call Writable again after each wake-up.
+func (w *PipeWriter) Writable() <-chan struct{} {
+	p := w.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return waitChanLocked(&p.writable, !p.buffer.full() || p.readerClosed || p.writerClosed)
+}
+
+// Closed returns a channel that is closed once either side of the pipe is closed.
+func (w *PipeWriter) Closed() <-chan struct{} {
+	return w.p.closedChan()
+}
+
+// WaitAny blocks until one of readers would not block on Read, because it has
+// data buffered or has been closed on either side, and returns its index.
+// It waits on the Readable channels directly, so no goroutine is started per
+// reader. If ctx is done first, WaitAny returns -1 and ctx.Err().
+func WaitAny(ctx context.Context, readers ...*PipeReader) (int, error) {
+	cases := make([]reflect.SelectCase, len(readers)+1)
+	for i, r := range readers {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.Readable())}
+	}
+	cases[len(readers)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+
+	chosen, _, _ := reflect.Select(cases)
+	if chosen == len(readers) {
+		return -1, ctx.Err()
+	}
+	return chosen, nil
+}
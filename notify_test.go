@@ -0,0 +1,130 @@
+package pipebuf_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestReadable(t *testing.T) {
+	r, w := newTestPipe(t, 4)
+
+	ready := r.Readable()
+	expectPending(t, ready)
+
+	mustWrite(t, w, []byte("ab"))
+	expectReady(t, ready)
+	expectReady(t, r.Readable())
+
+	mustRead(t, r, []byte("ab"))
+	expectPending(t, r.Readable())
+
+	w.Close()
+	expectReady(t, r.Readable())
+}
+
+func TestWritable(t *testing.T) {
+	r, w := newTestPipe(t, 2)
+
+	expectReady(t, w.Writable())
+
+	mustWrite(t, w, []byte("ab"))
+	ready := w.Writable()
+	expectPending(t, ready)
+
+	mustRead(t, r, []byte("a"))
+	expectReady(t, ready)
+}
+
+func TestClosed(t *testing.T) {
+	r, w := newTestPipe(t, 2)
+
+	closed := r.Closed()
+	expectPending(t, closed)
+	expectPending(t, w.Closed())
+
+	r.Close()
+	expectReady(t, closed)
+	expectReady(t, w.Closed())
+	expectReady(t, w.Writable())
+}
+
+func TestReadableSelect(t *testing.T) {
+	r, w := newTestPipe(t, 4)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mustWrite(t, w, []byte("x"))
+	}()
+
+	select {
+	case <-r.Readable():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Readable")
+	}
+	mustRead(t, r, []byte("x"))
+}
+
+func TestWaitAny(t *testing.T) {
+	readers := make([]*pipebuf.PipeReader, 100)
+	writers := make([]*pipebuf.PipeWriter, len(readers))
+	for i := range readers {
+		readers[i], writers[i] = newTestPipe(t, 4)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mustWrite(t, writers[42], []byte("x"))
+	}()
+
+	i, err := pipebuf.WaitAny(context.Background(), readers...)
+	if err != nil {
+		t.Fatalf("WaitAny failed: %v", err)
+	}
+	if i != 42 {
+		t.Fatalf("expected reader 42, got %d", i)
+	}
+
+	writers[7].Close()
+	readers[42].Close()
+	i, err = pipebuf.WaitAny(context.Background(), readers[:10]...)
+	if err != nil {
+		t.Fatalf("WaitAny failed: %v", err)
+	}
+	if i != 7 {
+		t.Fatalf("expected reader 7, got %d", i)
+	}
+}
+
+func TestWaitAnyContext(t *testing.T) {
+	r, _ := newTestPipe(t, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	i, err := pipebuf.WaitAny(ctx, r)
+	expectError(t, err, context.DeadlineExceeded)
+	if i != -1 {
+		t.Fatalf("expected index -1, got %d", i)
+	}
+}
+
+func expectReady(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	default:
+		t.Fatal("expected channel to be ready")
+	}
+}
+
+func expectPending(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Fatal("expected channel to be pending")
+	default:
+	}
+}
@@ -0,0 +1,47 @@
+package pipebuf
+
+// Option configures a pipe created by Pipe.
+type Option func(*options)
+
+type options struct {
+	atomicWrites int
+	history      int
+	budget       *Budget
+	minSize      int
+}
+
+// WithAtomicWrites mirrors the POSIX PIPE_BUF guarantee: a Write of at most n
+// bytes waits until the whole write fits and is placed in the buffer in one
+// piece, so a reader never observes part of it. Larger writes may still be
+// split. n is capped at the buffer size.
+func WithAtomicWrites(n int) Option {
+	return func(o *options) {
+		o.atomicWrites = n
+	}
+}
+
+// WithHistory keeps the last n bytes consumed by the reader in the buffer, in
+// addition to its size, so they can be read again with PipeReader.Rewind or
+// PipeReader.RewindToMark. Retained bytes never make the writer wait.
+func WithHistory(n int) Option {
+	return func(o *options) {
+		o.history = n
+	}
+}
+
+// WithBudget makes the pipe start with a buffer of minSize bytes and grow
+// towards its full size while b has room, so many pipes share one cap on
+// memory. A full buffer grows straight to fit the pending write. The minimum
+// buffer is not drawn from b: every pipe can always make progress, and a
+// write that finds the buffer full and the budget spent waits for the reader
+// as with any full pipe. A drained buffer keeps its growth for the next
+// burst; it shrinks back to minSize, returning the growth to b, once the
+// writer is closed and the buffer drained, when the reader is closed, or when
+// another pipe sharing b runs short. minSize is raised to the
+// WithAtomicWrites size and capped at the buffer size.
+func WithBudget(b *Budget, minSize int) Option {
+	return func(o *options) {
+		o.budget = b
+		o.minSize = minSize
+	}
+}
@@ -2,10 +2,13 @@ package pipebuf_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
+	"net"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/jacoelho/pipebuf"
 )
@@ -273,7 +276,7 @@ func TestIOCopyFromReader(t *testing.T) {
 	}
 }
 
-func TestReadBufferedDataAfterReaderClose(t *testing.T) {
+func TestReaderCloseDiscardsBufferedData(t *testing.T) {
 	r, w := newTestPipe(t, 10)
 
 	testData := "test"
@@ -281,14 +284,16 @@ func TestReadBufferedDataAfterReaderClose(t *testing.T) {
 
 	r.Close()
 
-	mustRead(t, r, []byte(testData))
+	if got := w.Discarded(); got != len(testData) {
+		t.Fatalf("expected %d discarded bytes, got %d", len(testData), got)
+	}
 
 	buf := make([]byte, 1)
 	_, err := r.Read(buf)
 	expectError(t, err, io.ErrClosedPipe)
 }
 
-func TestReadBufferedDataAfterReaderCloseWithError(t *testing.T) {
+func TestReaderCloseWithErrorDiscardsBufferedData(t *testing.T) {
 	r, w := newTestPipe(t, 10)
 
 	testData := "test"
@@ -297,13 +302,27 @@ func TestReadBufferedDataAfterReaderCloseWithError(t *testing.T) {
 	customErr := errors.New("custom close error")
 	r.CloseWithError(customErr)
 
-	mustRead(t, r, []byte(testData))
+	if got := w.Discarded(); got != len(testData) {
+		t.Fatalf("expected %d discarded bytes, got %d", len(testData), got)
+	}
 
 	buf := make([]byte, 1)
 	_, err := r.Read(buf)
 	expectError(t, err, customErr)
 }
 
+func TestDiscardedAfterDrain(t *testing.T) {
+	r, w := newTestPipe(t, 10)
+
+	mustWrite(t, w, []byte("test"))
+	mustRead(t, r, []byte("test"))
+	r.Close()
+
+	if got := w.Discarded(); got != 0 {
+		t.Fatalf("expected 0 discarded bytes, got %d", got)
+	}
+}
+
 func TestBufferSizes(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -636,8 +655,6 @@ func TestReadAfterReaderClose(t *testing.T) {
 	mustWrite(t, w, []byte("data"))
 	r.Close()
 
-	mustRead(t, r, []byte("data"))
-
 	buf := make([]byte, 1)
 	_, err := r.Read(buf)
 	expectError(t, err, io.ErrClosedPipe)
@@ -731,7 +748,7 @@ func mustRead(t *testing.T, r io.Reader, expected []byte) {
 
 func expectError(t *testing.T, err, expected error) {
 	t.Helper()
-	if err != expected {
+	if !errors.Is(err, expected) {
 		t.Fatalf("expected %v, got %v", expected, err)
 	}
 }
@@ -798,3 +815,424 @@ func TestSamePipeDeadlockPrevention(t *testing.T) {
 		}
 	})
 }
+
+func TestCloseWriteAndWait(t *testing.T) {
+	t.Run("Drained", func(t *testing.T) {
+		r, w := newTestPipe(t, 10)
+
+		mustWrite(t, w, []byte("data"))
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			_, _ = io.Copy(io.Discard, r)
+		})
+
+		unread, err := w.CloseWriteAndWait(context.Background())
+		if err != nil {
+			t.Fatalf("CloseWriteAndWait failed: %v", err)
+		}
+		if unread != 0 {
+			t.Fatalf("expected 0 unread bytes, got %d", unread)
+		}
+		wg.Wait()
+	})
+
+	t.Run("ReaderClosed", func(t *testing.T) {
+		r, w := newTestPipe(t, 10)
+
+		mustWrite(t, w, []byte("data"))
+
+		go func() {
+			mustRead(t, r, []byte("da"))
+			r.Close()
+		}()
+
+		unread, err := w.CloseWriteAndWait(context.Background())
+		if err != nil {
+			t.Fatalf("CloseWriteAndWait failed: %v", err)
+		}
+		if unread != 2 {
+			t.Fatalf("expected 2 unread bytes, got %d", unread)
+		}
+	})
+
+	t.Run("ContextExpired", func(t *testing.T) {
+		_, w := newTestPipe(t, 10)
+
+		mustWrite(t, w, []byte("data"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		unread, err := w.CloseWriteAndWait(ctx)
+		expectError(t, err, context.DeadlineExceeded)
+		if unread != 4 {
+			t.Fatalf("expected 4 unread bytes, got %d", unread)
+		}
+	})
+}
+
+func TestClosedError(t *testing.T) {
+	writeOp := func(_ *pipebuf.PipeReader, w *pipebuf.PipeWriter) error {
+		_, err := w.Write([]byte("x"))
+		return err
+	}
+	readOp := func(r *pipebuf.PipeReader, _ *pipebuf.PipeWriter) error {
+		_, err := r.Read(make([]byte, 1))
+		return err
+	}
+	causeErr := errors.New("consumer went away")
+
+	tests := []struct {
+		name   string
+		close  func(r *pipebuf.PipeReader, w *pipebuf.PipeWriter)
+		op     func(r *pipebuf.PipeReader, w *pipebuf.PipeWriter) error
+		cause  error
+		remote bool
+	}{
+		{
+			name:   "WriteAfterReaderClose",
+			close:  func(r *pipebuf.PipeReader, _ *pipebuf.PipeWriter) { r.Close() },
+			op:     writeOp,
+			remote: true,
+		},
+		{
+			name:   "WriteAfterReaderCloseWithError",
+			close:  func(r *pipebuf.PipeReader, _ *pipebuf.PipeWriter) { r.CloseWithError(causeErr) },
+			op:     writeOp,
+			cause:  causeErr,
+			remote: true,
+		},
+		{
+			name:  "WriteAfterWriterClose",
+			close: func(_ *pipebuf.PipeReader, w *pipebuf.PipeWriter) { w.Close() },
+			op:    writeOp,
+		},
+		{
+			name: "WriteAfterBothClose",
+			close: func(r *pipebuf.PipeReader, w *pipebuf.PipeWriter) {
+				w.CloseWithError(causeErr)
+				r.Close()
+			},
+			op:    writeOp,
+			cause: causeErr,
+		},
+		{
+			name:  "ReadAfterReaderCloseWithError",
+			close: func(r *pipebuf.PipeReader, _ *pipebuf.PipeWriter) { r.CloseWithError(causeErr) },
+			op:    readOp,
+			cause: causeErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w := newTestPipe(t, 10)
+
+			tt.close(r, w)
+			err := tt.op(r, w)
+
+			var closedErr *pipebuf.ClosedError
+			if !errors.As(err, &closedErr) {
+				t.Fatalf("expected ClosedError, got %v", err)
+			}
+			if !errors.Is(err, io.ErrClosedPipe) {
+				t.Fatalf("expected error to match io.ErrClosedPipe, got %v", err)
+			}
+			if closedErr.Err != tt.cause {
+				t.Fatalf("expected cause %v, got %v", tt.cause, closedErr.Err)
+			}
+			if closedErr.Remote != tt.remote {
+				t.Fatalf("expected Remote=%v, got %v", tt.remote, closedErr.Remote)
+			}
+		})
+	}
+}
+
+func TestWriteBuffers(t *testing.T) {
+	t.Run("Fits", func(t *testing.T) {
+		r, w := newTestPipe(t, 16)
+
+		n, err := w.WriteBuffers(net.Buffers{[]byte("head"), []byte("body")})
+		if err != nil {
+			t.Fatalf("WriteBuffers failed: %v", err)
+		}
+		if n != 8 {
+			t.Fatalf("expected to write 8 bytes, wrote %d", n)
+		}
+		mustRead(t, r, []byte("headbody"))
+	})
+
+	t.Run("LargerThanBuffer", func(t *testing.T) {
+		r, w := newTestPipe(t, 3)
+
+		bufs := [][]byte{[]byte("header:"), []byte("payload"), nil, []byte("!")}
+
+		var wg sync.WaitGroup
+		var writeErr error
+		wg.Go(func() {
+			defer w.Close()
+			_, writeErr = w.WriteBuffers(bufs)
+		})
+
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		wg.Wait()
+		if writeErr != nil {
+			t.Fatalf("WriteBuffers failed: %v", writeErr)
+		}
+		if string(got) != "header:payload!" {
+			t.Fatalf("expected %q, got %q", "header:payload!", got)
+		}
+	})
+
+	t.Run("ReaderClosed", func(t *testing.T) {
+		r, w := newTestPipe(t, 4)
+		r.Close()
+
+		_, err := w.WriteBuffers([][]byte{[]byte("x")})
+		expectError(t, err, io.ErrClosedPipe)
+	})
+}
+
+func TestReadBuffers(t *testing.T) {
+	t.Run("Scatter", func(t *testing.T) {
+		r, w := newTestPipe(t, 16)
+
+		mustWrite(t, w, []byte("headpayload"))
+
+		header := make([]byte, 4)
+		payload := make([]byte, 16)
+		n, err := r.ReadBuffers([][]byte{header, payload})
+		if err != nil {
+			t.Fatalf("ReadBuffers failed: %v", err)
+		}
+		if n != 11 {
+			t.Fatalf("expected to read 11 bytes, read %d", n)
+		}
+		if string(header) != "head" || string(payload[:n-4]) != "payload" {
+			t.Fatalf("unexpected segments %q, %q", header, payload[:n-4])
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		r, _ := newTestPipe(t, 4)
+
+		// Like Read with an empty slice, this must not wait for data.
+		for _, bufs := range [][][]byte{nil, {nil, {}}} {
+			n, err := r.ReadBuffers(bufs)
+			if n != 0 || err != nil {
+				t.Fatalf("expected 0, nil, got %d, %v", n, err)
+			}
+		}
+	})
+
+	t.Run("WrapAround", func(t *testing.T) {
+		r, w := newTestPipe(t, 4)
+
+		mustWrite(t, w, []byte("abcd"))
+		mustRead(t, r, []byte("ab"))
+		mustWrite(t, w, []byte("ef"))
+
+		a, b := make([]byte, 3), make([]byte, 3)
+		n, err := r.ReadBuffers([][]byte{a, b})
+		if err != nil {
+			t.Fatalf("ReadBuffers failed: %v", err)
+		}
+		if n != 4 || string(a) != "cde" || string(b[:1]) != "f" {
+			t.Fatalf("unexpected result n=%d %q %q", n, a, b[:1])
+		}
+	})
+
+	t.Run("EOF", func(t *testing.T) {
+		r, w := newTestPipe(t, 4)
+		w.Close()
+
+		_, err := r.ReadBuffers([][]byte{make([]byte, 1)})
+		expectError(t, err, io.EOF)
+	})
+}
+
+func TestAtomicWrites(t *testing.T) {
+	r, w := pipebuf.Pipe(8, pipebuf.WithAtomicWrites(4))
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+
+	mustWrite(t, w, []byte("abcdef"))
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		mustWrite(t, w, []byte("wxyz"))
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	buf := make([]byte, 16)
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(buf[:n]) != "abcdef" {
+		t.Fatalf("expected %q before the atomic write lands, got %q", "abcdef", buf[:n])
+	}
+
+	wg.Wait()
+	mustRead(t, r, []byte("wxyz"))
+}
+
+func TestWritersServedInArrivalOrder(t *testing.T) {
+	r, w := newTestPipe(t, 2)
+
+	mustWrite(t, w, []byte("--"))
+
+	var wg sync.WaitGroup
+	for _, s := range []string{"aaaa", "bbbb", "cccc", "dddd"} {
+		wg.Go(func() {
+			mustWrite(t, w, []byte(s))
+		})
+		time.Sleep(10 * time.Millisecond) // let the writer queue up
+	}
+	go func() {
+		wg.Wait()
+		w.Close()
+	}()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(got) != "--aaaabbbbccccdddd" {
+		t.Fatalf("expected writers in arrival order, got %q", got)
+	}
+}
+
+func TestPipeToPipe(t *testing.T) {
+	testData := make([]byte, 256*1024)
+	for i := range testData {
+		testData[i] = byte(i % 251)
+	}
+
+	for _, name := range []string{"WriteTo", "ReadFrom"} {
+		t.Run(name, func(t *testing.T) {
+			r1, w1 := newTestPipe(t, 1024)
+			r2, w2 := newTestPipe(t, 333)
+
+			var wg sync.WaitGroup
+			wg.Go(func() {
+				defer w1.Close()
+				mustWrite(t, w1, testData)
+			})
+			wg.Go(func() {
+				defer w2.Close()
+				var err error
+				if name == "WriteTo" {
+					_, err = r1.WriteTo(w2)
+				} else {
+					_, err = w2.ReadFrom(r1)
+				}
+				if err != nil {
+					t.Errorf("%s failed: %v", name, err)
+				}
+			})
+
+			got, err := io.ReadAll(r2)
+			if err != nil {
+				t.Fatalf("ReadAll failed: %v", err)
+			}
+			wg.Wait()
+			if !bytes.Equal(got, testData) {
+				t.Fatalf("data integrity check failed")
+			}
+		})
+	}
+}
+
+func TestPipeToPipeBothDirections(t *testing.T) {
+	ra, wa := newTestPipe(t, 8)
+	rb, wb := newTestPipe(t, 8)
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		_, _ = ra.WriteTo(wb)
+	})
+	wg.Go(func() {
+		_, _ = rb.WriteTo(wa)
+	})
+
+	mustWrite(t, wa, []byte("ping"))
+	time.Sleep(10 * time.Millisecond)
+
+	ra.Close()
+	rb.Close()
+	wg.Wait()
+}
+
+func TestPipeToPipeDownstreamClosed(t *testing.T) {
+	r1, w1 := newTestPipe(t, 8)
+	r2, w2 := newTestPipe(t, 8)
+
+	customErr := errors.New("downstream gone")
+	r2.CloseWithError(customErr)
+	mustWrite(t, w1, []byte("data"))
+
+	_, err := r1.WriteTo(w2)
+	expectError(t, err, customErr)
+}
+
+func TestReadFromWrapAround(t *testing.T) {
+	r, w := newTestPipe(t, 4)
+
+	mustWrite(t, w, []byte("ab"))
+	mustRead(t, r, []byte("ab"))
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer w.Close()
+		n, err := w.ReadFrom(bytes.NewReader([]byte("cdefghij")))
+		if err != nil || n != 8 {
+			t.Errorf("ReadFrom returned %d, %v", n, err)
+		}
+	})
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	wg.Wait()
+	if string(got) != "cdefghij" {
+		t.Fatalf("expected %q, got %q", "cdefghij", got)
+	}
+}
+
+func TestReadFromInvalidCount(t *testing.T) {
+	_, w := newTestPipe(t, 4)
+
+	_, err := w.ReadFrom(invalidReader{})
+	if err == nil {
+		t.Fatal("expected error for invalid read count")
+	}
+}
+
+func TestWriteToShortWrite(t *testing.T) {
+	r, w := newTestPipe(t, 8)
+
+	mustWrite(t, w, []byte("abcdef"))
+	w.Close()
+
+	fw := &failingWriterTest{failAfter: 2}
+	n, err := r.WriteTo(fw)
+	expectError(t, err, io.ErrShortWrite)
+	if n != 2 {
+		t.Fatalf("expected 2 bytes written, got %d", n)
+	}
+	mustRead(t, r, []byte("cdef"))
+}
+
+type invalidReader struct{}
+
+func (invalidReader) Read(p []byte) (int, error) {
+	return len(p) + 1, nil
+}
@@ -1,8 +1,10 @@
 package pipebuf
 
 import (
+	"context"
 	"errors"
 	"io"
+	"slices"
 	"sync"
 )
 
@@ -10,8 +12,48 @@ var (
 	// ErrSamePipe is returned when attempting to copy data from a pipe to itself,
 	// which would cause a deadlock.
 	ErrSamePipe = errors.New("cannot copy to/from same pipe")
+
+	errInvalidRead = errors.New("pipebuf: reader returned invalid count")
 )
 
+// ClosedError is returned by reads and writes on a closed pipe.
+// It matches io.ErrClosedPipe with errors.Is and wraps the error
+// passed to CloseWithError, if any.
+type ClosedError struct {
+	// Err is the error passed to CloseWithError, or nil.
+	Err error
+	// Remote reports whether the other side of the pipe was closed,
+	// rather than the side performing the operation.
+	Remote bool
+}
+
+func (e *ClosedError) Error() string {
+	msg := "pipebuf: pipe closed by local side"
+	if e.Remote {
+		msg = "pipebuf: pipe closed by remote side"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ClosedError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{io.ErrClosedPipe}
+	}
+	return []error{io.ErrClosedPipe, e.Err}
+}
+
+// closedError builds a ClosedError, dropping the default close errors
+// that only record that a side was closed without a cause.
+func closedError(cause error, remote bool) error {
+	if cause == io.ErrClosedPipe || cause == io.EOF {
+		cause = nil
+	}
+	return &ClosedError{Err: cause, Remote: remote}
+}
+
 var (
 	_ io.Reader     = (*PipeReader)(nil)
 	_ io.WriterTo   = (*PipeReader)(nil)
@@ -21,11 +63,37 @@ var (
 	_ io.Closer     = (*PipeWriter)(nil)
 )
 
-type pipe struct {
+type pipe[T any] struct {
 	readerClosedErr error
 	writerClosedErr error
 
-	buffer *ringBuffer
+	buffer *ringBuffer[T]
+
+	discarded int
+
+	// atomicWrites is the largest write that is placed in the buffer in one piece.
+	atomicWrites int
+
+	// budget, if set, is charged for growing the buffer from minSize up to
+	// maxSize; charged is the growth drawn from it so far, and idle whether
+	// the pipe is listed as able to give it back.
+	budget  *Budget
+	minSize int
+	maxSize int
+	charged int
+	idle    bool
+
+	// mark is the stream offset recorded by Mark.
+	mark uint64
+
+	readable chan struct{}
+	writable chan struct{}
+	closed   chan struct{}
+
+	// Writers and readers are served in arrival order; only the one whose
+	// turn it is waits on writerWait or readerWait.
+	writerTurn turnQueue
+	readerTurn turnQueue
 
 	writerWait sync.Cond
 	readerWait sync.Cond
@@ -36,39 +104,219 @@ type pipe struct {
 	writerClosed bool
 }
 
-func newPipe(size int) *pipe {
-	p := &pipe{buffer: newRingBuffer(size)}
+func newPipe[T any](size, history int) *pipe[T] {
+	p := &pipe[T]{buffer: newRingBuffer[T](size, history)}
 	p.writerWait.L = &p.mu
 	p.readerWait.L = &p.mu
 	return p
 }
 
-func (p *pipe) Read(b []byte) (n int, err error) {
+// waitWriterTurnLocked blocks until every writer that arrived earlier has
+// finished. The caller must call doneWriterTurnLocked when it is done.
+func (p *pipe[T]) waitWriterTurnLocked() {
+	p.writerTurn.wait(&p.mu)
+}
+
+func (p *pipe[T]) doneWriterTurnLocked() {
+	p.writerTurn.done()
+}
+
+// waitReaderTurnLocked blocks until every reader that arrived earlier has
+// finished. The caller must call doneReaderTurnLocked when it is done.
+func (p *pipe[T]) waitReaderTurnLocked() {
+	p.readerTurn.wait(&p.mu)
+}
+
+func (p *pipe[T]) doneReaderTurnLocked() {
+	p.readerTurn.done()
+}
+
+func (p *pipe[T]) Read(b []T) (n int, err error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.waitReaderTurnLocked()
+	defer p.doneReaderTurnLocked()
+	return p.readLocked(b)
+}
+
+// readLocked reads into b once data is available. The caller must hold the
+// reader turn.
+func (p *pipe[T]) readLocked(b []T) (int, error) {
 	if err := p.waitForDataLocked(); err != nil {
 		return 0, err
 	}
 
 	wasFull := p.buffer.full()
-	n = p.buffer.read(b)
+	n := p.buffer.read(b)
+	p.readDoneLocked(wasFull)
 
-	if wasFull {
-		p.writerWait.Signal()
+	return n, nil
+}
+
+// readBuffers fills the segments of bufs in order with the buffered data,
+// waiting for data and waking the writer at most once.
+func (p *pipe[T]) readBuffers(bufs [][]T) (n int64, err error) {
+	if !slices.ContainsFunc(bufs, func(b []T) bool { return len(b) > 0 }) {
+		return 0, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitReaderTurnLocked()
+	defer p.doneReaderTurnLocked()
+	if err := p.waitForDataLocked(); err != nil {
+		return 0, err
+	}
+
+	wasFull := p.buffer.full()
+	for _, b := range bufs {
+		if p.buffer.empty() {
+			break
+		}
+		n += int64(p.buffer.read(b))
 	}
+	p.readDoneLocked(wasFull)
 
 	return n, nil
 }
 
-func (p *pipe) Write(b []byte) (n int, err error) {
+// writeTo hands buffered data to write straight from the ring, without an
+// intermediate buffer, until the writer side is closed. write receives the
+// unread data as up to two segments and reports how much it consumed.
+// The pipe lock is not held while write runs, so write may block on, or
+// write to, another pipe; holding the reader turn keeps the segments from
+// being consumed meanwhile.
+func (p *pipe[T]) writeTo(write func(first, second []T) (int, error)) (n int64, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitReaderTurnLocked()
+	defer p.doneReaderTurnLocked()
+	for {
+		if err := p.waitForDataLocked(); err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+
+		first, second := p.buffer.peek()
+		p.mu.Unlock()
+		wn, wErr := write(first, second)
+		p.mu.Lock()
+
+		if wn < 0 || wn > len(first)+len(second) {
+			wn = 0
+			if wErr == nil {
+				wErr = io.ErrShortWrite
+			}
+		}
+		if !p.readerClosed { // closing the reader already discarded the buffer
+			wasFull := p.buffer.full()
+			p.buffer.skip(wn)
+			p.readDoneLocked(wasFull)
+		}
+		n += int64(wn)
+		if wErr != nil {
+			return n, wErr
+		}
+		if wn == 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+}
+
+// readFrom lets read fill the free space of the ring directly, without an
+// intermediate buffer, until read returns an error. read receives the free
+// space as up to two segments and fills them in order. Like writeTo, the
+// pipe lock is released while read runs; holding the writer turn keeps the
+// reserved space from being handed to anyone else.
+func (p *pipe[T]) readFrom(read func(first, second []T) (int, error)) (n int64, err error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.waitWriterTurnLocked()
+	defer p.doneWriterTurnLocked()
+	for {
+		if err := p.waitForSpaceLocked(1, p.buffer.size); err != nil {
+			return n, err
+		}
+
+		first, second := p.buffer.reserve()
+		p.mu.Unlock()
+		rn, rErr := read(first, second)
+		p.mu.Lock()
+
+		if rn < 0 || rn > len(first)+len(second) {
+			return n, errInvalidRead
+		}
+		if rn > 0 && !p.readerClosed && !p.writerClosed {
+			wasEmpty := p.buffer.empty()
+			p.buffer.commit(rn)
+			if wasEmpty {
+				p.wakeReaderLocked()
+			}
+			n += int64(rn)
+		}
+		if rErr != nil {
+			if rErr == io.EOF {
+				return n, nil
+			}
+			return n, rErr
+		}
+	}
+}
+
+// writeFirst adapts a plain write function to writeTo by handing it the first
+// segment only; a short write is reported as io.ErrShortWrite.
+func writeFirst[T any](write func([]T) (int, error)) func(first, second []T) (int, error) {
+	return func(first, _ []T) (int, error) {
+		n, err := write(first)
+		if err == nil && n != len(first) {
+			err = io.ErrShortWrite
+		}
+		return n, err
+	}
+}
+
+// readFirst adapts a plain read function to readFrom by handing it the first
+// segment only.
+func readFirst[T any](read func([]T) (int, error)) func(first, second []T) (int, error) {
+	return func(first, _ []T) (int, error) {
+		return read(first)
+	}
+}
+
+func (p *pipe[T]) readDoneLocked(wasFull bool) {
+	if p.atomicWrites > 0 {
+		// The writer whose turn it is may be waiting for more than one free slot.
+		p.writerWait.Signal()
+		if wasFull {
+			wakeChanLocked(&p.writable)
+		}
+	} else if wasFull {
+		p.wakeWriterLocked()
+	}
+	if p.buffer.empty() {
+		if p.writerClosed {
+			p.writerWait.Broadcast()
+		}
+		p.drainedLocked()
+	}
+}
+
+func (p *pipe[T]) Write(b []T) (n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitWriterTurnLocked()
+	defer p.doneWriterTurnLocked()
+	need := 1
+	if len(b) <= p.atomicWrites {
+		need = len(b)
+	}
 	for len(b) > 0 {
-		if err := p.waitForSpaceLocked(); err != nil {
+		if err := p.waitForSpaceLocked(need, len(b)); err != nil {
 			return n, err
 		}
 		wasEmpty := p.buffer.empty()
@@ -76,20 +324,74 @@ func (p *pipe) Write(b []byte) (n int, err error) {
 		b = b[wrote:]
 		n += wrote
 		if wasEmpty {
-			p.readerWait.Signal()
+			p.wakeReaderLocked()
+		}
+	}
+	return n, nil
+}
+
+// writeBuffers writes every segment of bufs under one lock acquisition and
+// wakes the reader once, unless it has to wait for space in between.
+func (p *pipe[T]) writeBuffers(bufs [][]T) (n int64, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitWriterTurnLocked()
+	defer p.doneWriterTurnLocked()
+	total := 0
+	for _, b := range bufs {
+		total += len(b)
+	}
+	need := total
+	if need > p.atomicWrites {
+		need = 1
+	}
+	wake := false
+	for _, b := range bufs {
+		for len(b) > 0 {
+			if wake && p.buffer.full() {
+				p.wakeReaderLocked()
+				wake = false
+			}
+			if err := p.waitForSpaceLocked(need, total-int(n)); err != nil {
+				return n, err
+			}
+			if p.buffer.empty() {
+				wake = true
+			}
+			wrote := p.buffer.write(b)
+			b = b[wrote:]
+			n += int64(wrote)
 		}
 	}
+	if wake {
+		p.wakeReaderLocked()
+	}
 	return n, nil
 }
 
-func (p *pipe) Close() error {
+func (p *pipe[T]) wakeReaderLocked() {
+	p.readerWait.Signal()
+	wakeChanLocked(&p.readable)
+}
+
+func (p *pipe[T]) wakeWriterLocked() {
+	p.writerWait.Signal()
+	wakeChanLocked(&p.writable)
+}
+
+func (p *pipe[T]) Close() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.closeReaderLocked(nil, false)
 	return nil
 }
 
-func (p *pipe) closeReaderLocked(err error, withErr bool) {
+func (p *pipe[T]) closeReaderLocked(err error, withErr bool) {
+	if !p.readerClosed {
+		p.discarded = p.buffer.len()
+		p.buffer.reset()
+		p.shrinkLocked()
+	}
 	p.readerClosed = true
 	if withErr && p.writerClosedErr == nil {
 		if err == nil {
@@ -99,9 +401,10 @@ func (p *pipe) closeReaderLocked(err error, withErr bool) {
 	}
 	p.readerWait.Broadcast()
 	p.writerWait.Broadcast()
+	p.wakeAllLocked()
 }
 
-func (p *pipe) closeWriterLocked(err error, withErr bool) {
+func (p *pipe[T]) closeWriterLocked(err error, withErr bool) {
 	p.writerClosed = true
 	if withErr && p.readerClosedErr == nil {
 		if err == nil {
@@ -111,25 +414,47 @@ func (p *pipe) closeWriterLocked(err error, withErr bool) {
 	}
 	p.readerWait.Broadcast()
 	p.writerWait.Broadcast()
+	p.wakeAllLocked()
 }
 
-func (p *pipe) closeWrite() error {
+func (p *pipe[T]) closeWrite() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.closeWriterLocked(nil, false)
 	return nil
 }
 
-func (p *pipe) waitForDataLocked() error {
+// waitDrained waits until the buffer is empty, the reader is closed or ctx is done.
+// It returns the number of bytes left unread.
+func (p *pipe[T]) waitDrained(ctx context.Context) (int, error) {
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.writerWait.Broadcast()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.buffer.empty() && !p.readerClosed {
+		if err := ctx.Err(); err != nil {
+			return p.buffer.len(), err
+		}
+		p.writerWait.Wait()
+	}
+	if p.readerClosed {
+		return p.discarded, nil
+	}
+	return 0, nil
+}
+
+func (p *pipe[T]) waitForDataLocked() error {
 	for {
 		if !p.buffer.empty() {
 			return nil
 		}
 		if p.readerClosed {
-			if p.writerClosedErr != nil {
-				return p.writerClosedErr
-			}
-			return io.ErrClosedPipe
+			return closedError(p.writerClosedErr, false)
 		}
 		if p.writerClosed {
 			if p.readerClosedErr != nil {
@@ -141,59 +466,87 @@ func (p *pipe) waitForDataLocked() error {
 	}
 }
 
-func (p *pipe) waitForSpaceLocked() error {
+// waitForSpaceLocked waits until at least need elements can be written. want
+// is how many the caller has to write, which a budgeted buffer grows to fit.
+func (p *pipe[T]) waitForSpaceLocked(need, want int) error {
 	for {
-		if p.readerClosed {
-			if p.writerClosedErr != nil {
-				return p.writerClosedErr
-			}
-			return io.ErrClosedPipe
-		}
 		if p.writerClosed {
-			return io.ErrClosedPipe
+			return closedError(p.readerClosedErr, false)
+		}
+		if p.readerClosed {
+			return closedError(p.writerClosedErr, true)
 		}
-		if !p.buffer.full() {
+		if p.buffer.free() >= need {
 			return nil
 		}
+		if p.growLocked(need, want) {
+			continue
+		}
 		p.writerWait.Wait()
 	}
 }
 
 // Pipe creates a buffered pipe with the specified buffer size.
-func Pipe(bufferSize int) (*PipeReader, *PipeWriter) {
+func Pipe(bufferSize int, opts ...Option) (*PipeReader, *PipeWriter) {
 	if bufferSize <= 0 {
 		bufferSize = 1
 	}
-	p := newPipe(bufferSize)
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	atomicWrites := min(o.atomicWrites, bufferSize)
+	size := bufferSize
+	if o.budget != nil {
+		size = min(max(o.minSize, atomicWrites, 1), bufferSize)
+	}
+	p := newPipe[byte](size, max(o.history, 0))
+	p.atomicWrites = atomicWrites
+	p.budget = o.budget
+	p.minSize, p.maxSize = size, bufferSize
 	return &PipeReader{p}, &PipeWriter{p}
 }
 
 // PipeReader is the read half of a pipe.
 type PipeReader struct {
-	p *pipe
+	p *pipe[byte]
 }
 
 // Read implements io.Reader.
+// Concurrent reads are served in arrival order.
 func (r *PipeReader) Read(b []byte) (int, error) {
 	return r.p.Read(b)
 }
 
 // Close closes the reader side of the pipe.
+// Any data still buffered is discarded; see PipeWriter.Discarded.
 func (r *PipeReader) Close() error {
 	return r.p.Close()
 }
 
 // WriteTo implements io.WriterTo by reading data from the pipe
 // and writing it to w until EOF or an error occurs.
+// w.Write is called directly with slices of the pipe's buffer, so when w
+// is the writer of another pipe, data moves directly between the two buffers.
 func (r *PipeReader) WriteTo(w io.Writer) (n int64, err error) {
 	if pw, ok := w.(*PipeWriter); ok && pw.p == r.p {
 		return 0, ErrSamePipe
 	}
-	return copyBuffered(r.Read, w.Write)
+	return r.p.writeTo(writeFirst(w.Write))
+}
+
+// ReadBuffers reads buffered data into the segments of bufs in order, filling
+// each before moving to the next. Like Read it blocks until some data is
+// available, but it acquires the pipe lock only once for all segments.
+// It returns the total number of bytes read.
+func (r *PipeReader) ReadBuffers(bufs [][]byte) (int64, error) {
+	return r.p.readBuffers(bufs)
 }
 
 // CloseWithError closes the reader side of the pipe with an error.
-// The error will be returned to future writes on the writer side.
+// The error will be wrapped in a ClosedError returned to future writes
+// on the writer side.
+// Any data still buffered is discarded; see PipeWriter.Discarded.
 func (r *PipeReader) CloseWithError(err error) error {
 	r.p.mu.Lock()
 	defer r.p.mu.Unlock()
@@ -203,21 +556,38 @@ func (r *PipeReader) CloseWithError(err error) error {
 
 // PipeWriter is the write half of a pipe.
 type PipeWriter struct {
-	p *pipe
+	p *pipe[byte]
 }
 
 // Write implements io.Writer.
+// Concurrent writes are served in arrival order, each one completing
+// before the next begins.
 func (w *PipeWriter) Write(b []byte) (int, error) {
 	return w.p.Write(b)
 }
 
+// WriteBuffers writes all segments of bufs, such as a net.Buffers, as one write.
+// The segments are copied under a single lock acquisition with a single reader
+// wakeup; when they fit in the free space a concurrent reader never observes
+// a partial set. With WithAtomicWrites, a set no larger than the threshold
+// waits until it fits.
+func (w *PipeWriter) WriteBuffers(bufs [][]byte) (int64, error) {
+	return w.p.writeBuffers(bufs)
+}
+
 // ReadFrom implements io.ReaderFrom by reading data from r
 // and writing it to the pipe until EOF or an error occurs.
+// r.Read is called directly with the free space of the pipe's buffer;
+// when r is the reader of another pipe, data moves directly between
+// the two buffers.
 func (w *PipeWriter) ReadFrom(r io.Reader) (n int64, err error) {
-	if pr, ok := r.(*PipeReader); ok && pr.p == w.p {
-		return 0, ErrSamePipe
+	if pr, ok := r.(*PipeReader); ok {
+		if pr.p == w.p {
+			return 0, ErrSamePipe
+		}
+		return pr.p.writeTo(writeFirst(w.p.Write))
 	}
-	return copyBuffered(r.Read, w.Write)
+	return w.p.readFrom(readFirst(r.Read))
 }
 
 // Close closes the writer side of the pipe.
@@ -225,6 +595,25 @@ func (w *PipeWriter) Close() error {
 	return w.p.closeWrite()
 }
 
+// Discarded returns the number of buffered bytes that were dropped
+// because the reader side was closed before reading them.
+func (w *PipeWriter) Discarded() int {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	return w.p.discarded
+}
+
+// CloseWriteAndWait closes the writer side of the pipe and waits until the reader
+// has drained the buffer, the reader has been closed, or ctx is done.
+// It returns the number of bytes left unread; the error is ctx.Err() when
+// the context expired before the buffer was drained.
+func (w *PipeWriter) CloseWriteAndWait(ctx context.Context) (int, error) {
+	w.p.mu.Lock()
+	w.p.closeWriterLocked(nil, false)
+	w.p.mu.Unlock()
+	return w.p.waitDrained(ctx)
+}
+
 // CloseWithError closes the writer side of the pipe with an error.
 // The error will be returned to future reads on the reader side.
 func (w *PipeWriter) CloseWithError(err error) error {
@@ -233,33 +622,3 @@ func (w *PipeWriter) CloseWithError(err error) error {
 	w.p.closeWriterLocked(err, true)
 	return nil
 }
-
-func copyBuffered(read func([]byte) (int, error), write func([]byte) (int, error)) (int64, error) {
-	buf := make([]byte, 32*1024)
-	var total int64
-	for {
-		n, rErr := read(buf)
-		if n > 0 {
-			wn, wErr := write(buf[:n])
-			if wn < 0 || wn > n {
-				wn = 0
-				if wErr == nil {
-					wErr = io.ErrShortWrite
-				}
-			}
-			total += int64(wn)
-			if wErr != nil {
-				return total, wErr
-			}
-			if wn != n {
-				return total, io.ErrShortWrite
-			}
-		}
-		if rErr != nil {
-			if rErr != io.EOF {
-				return total, rErr
-			}
-			return total, nil
-		}
-	}
-}
@@ -0,0 +1,95 @@
+package pipebuf
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// errStageDone closes a stage's input after it returned successfully without
+// consuming all of it; the upstream stage's resulting write error is not
+// reported as a pipeline failure.
+var errStageDone = errors.New("pipebuf: downstream stage finished")
+
+// Stage is one step of a Pipeline. It reads its input from r and writes its
+// output to w, returning when it is done or has failed.
+type Stage func(r io.Reader, w io.Writer) error
+
+// Pipeline runs a chain of stages concurrently, connected by bounded pipes.
+// When a stage fails, the pipes on both sides of it are closed with its error,
+// so the stages before and after it stop instead of blocking.
+type Pipeline struct {
+	bufferSize int
+	stages     []Stage
+
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
+
+// NewPipeline returns a pipeline running stages in order, with a pipe of
+// bufferSize bytes between each pair of consecutive stages.
+func NewPipeline(bufferSize int, stages ...Stage) *Pipeline {
+	return &Pipeline{bufferSize: bufferSize, stages: stages}
+}
+
+// Start runs the stages in their own goroutines. The first stage reads from
+// src and the last writes to dst; neither is closed by the pipeline.
+func (p *Pipeline) Start(src io.Reader, dst io.Writer) {
+	var up *PipeReader // input pipe of the current stage, nil for the first
+	for i, stage := range p.stages {
+		var in io.Reader = src
+		if up != nil {
+			in = up
+		}
+		var (
+			out  io.Writer = dst
+			next *PipeReader
+			down *PipeWriter
+		)
+		if i < len(p.stages)-1 {
+			next, down = Pipe(p.bufferSize)
+			out = down
+		}
+		stageUp := up
+		p.wg.Go(func() {
+			p.run(stage, in, out, stageUp, down)
+		})
+		up = next
+	}
+}
+
+// run runs a single stage and closes the pipes around it: with the stage's
+// error when it failed, so both neighbours stop, or normally when it is done.
+func (p *Pipeline) run(stage Stage, in io.Reader, out io.Writer, up *PipeReader, down *PipeWriter) {
+	err := stage(in, out)
+	if err != nil && !errors.Is(err, errStageDone) {
+		p.once.Do(func() {
+			p.err = err
+		})
+	}
+
+	if up != nil {
+		upErr := err
+		if upErr == nil {
+			upErr = errStageDone
+		}
+		up.CloseWithError(upErr)
+	}
+	if down != nil {
+		down.CloseWithError(err)
+	}
+}
+
+// Wait waits for every stage to return and reports the first error
+// returned by a stage, if any.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	return p.err
+}
+
+// Run starts the pipeline and waits for it to finish.
+func (p *Pipeline) Run(src io.Reader, dst io.Writer) error {
+	p.Start(src, dst)
+	return p.Wait()
+}
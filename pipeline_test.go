@@ -0,0 +1,92 @@
+package pipebuf_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestPipeline(t *testing.T) {
+	input := strings.Repeat("compress me please ", 2000)
+
+	var out bytes.Buffer
+	p := pipebuf.NewPipeline(64,
+		func(r io.Reader, w io.Writer) error {
+			zw := gzip.NewWriter(w)
+			if _, err := io.Copy(zw, r); err != nil {
+				return err
+			}
+			return zw.Close()
+		},
+		func(r io.Reader, w io.Writer) error {
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, zr)
+			return err
+		},
+		func(r io.Reader, w io.Writer) error {
+			_, err := io.Copy(w, r)
+			return err
+		},
+	)
+
+	if err := p.Run(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out.String() != input {
+		t.Fatalf("pipeline output mismatch: got %d bytes", out.Len())
+	}
+}
+
+func TestPipelineStageError(t *testing.T) {
+	stageErr := errors.New("encrypt failed")
+
+	var upstreamErr, downstreamErr error
+	p := pipebuf.NewPipeline(8,
+		func(r io.Reader, w io.Writer) error {
+			// Produces more than the pipe holds, so it blocks until the failure.
+			_, upstreamErr = w.Write(bytes.Repeat([]byte("x"), 1024))
+			return upstreamErr
+		},
+		func(r io.Reader, w io.Writer) error {
+			return stageErr
+		},
+		func(r io.Reader, w io.Writer) error {
+			_, downstreamErr = io.Copy(w, r)
+			return downstreamErr
+		},
+	)
+
+	err := p.Run(strings.NewReader(""), io.Discard)
+	expectError(t, err, stageErr)
+	expectError(t, upstreamErr, stageErr)
+	expectError(t, downstreamErr, stageErr)
+}
+
+func TestPipelineStageStopsEarly(t *testing.T) {
+	var out bytes.Buffer
+	p := pipebuf.NewPipeline(8,
+		func(r io.Reader, w io.Writer) error {
+			_, err := io.Copy(w, r)
+			return err
+		},
+		func(r io.Reader, w io.Writer) error {
+			_, err := io.CopyN(w, r, 4)
+			return err
+		},
+	)
+
+	if err := p.Run(strings.NewReader(strings.Repeat("y", 1024)), &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out.String() != "yyyy" {
+		t.Fatalf("expected %q, got %q", "yyyy", out.String())
+	}
+}
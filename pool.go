@@ -0,0 +1,77 @@
+package pipebuf
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrPipeInUse is returned by Reset when a side of the pipe is still open or
+// a read or write on it has not returned yet.
+var ErrPipeInUse = errors.New("pipebuf: reset of a pipe still in use")
+
+// reset returns a closed, idle pipe to its initial open state, keeping the
+// buffer allocation and the options it was created with.
+func (p *pipe[T]) reset() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.readerClosed || !p.writerClosed ||
+		p.readerTurn.busy || p.writerTurn.busy {
+		return ErrPipeInUse
+	}
+
+	p.buffer.histOff, p.buffer.readOff, p.buffer.writeOff = 0, 0, 0
+	p.readerClosed, p.writerClosed = false, false
+	p.readerClosedErr, p.writerClosedErr = nil, nil
+	p.discarded = 0
+	p.mark = 0
+	p.readable, p.writable, p.closed = nil, nil, nil
+	return nil
+}
+
+// Reset returns the pipe to the state Pipe created it in, reusing its buffer.
+// Both halves must be closed and no call on either may be in progress,
+// otherwise Reset fails with ErrPipeInUse.
+func (r *PipeReader) Reset() error {
+	return r.p.reset()
+}
+
+// Reset returns the pipe to the state Pipe created it in, reusing its buffer.
+// Both halves must be closed and no call on either may be in progress,
+// otherwise Reset fails with ErrPipeInUse.
+func (w *PipeWriter) Reset() error {
+	return w.p.reset()
+}
+
+// PipePool recycles pipes of one buffer size and set of options, so short
+// lived pipes don't allocate a buffer each time. It is safe for concurrent
+// use.
+type PipePool struct {
+	pool sync.Pool
+}
+
+// NewPipePool returns a pool of pipes created with Pipe(bufferSize, opts...).
+func NewPipePool(bufferSize int, opts ...Option) *PipePool {
+	pp := &PipePool{}
+	pp.pool.New = func() any {
+		r, _ := Pipe(bufferSize, opts...)
+		return r.p
+	}
+	return pp
+}
+
+// Get returns an open pipe from the pool, creating one if needed.
+func (pp *PipePool) Get() (*PipeReader, *PipeWriter) {
+	p := pp.pool.Get().(*pipe[byte])
+	return &PipeReader{p}, &PipeWriter{p}
+}
+
+// Put closes both halves of a pipe obtained from Get and returns it to the
+// pool. A pipe with a call still in progress, or halves of different pipes,
+// are dropped instead. Neither half may be used after Put.
+func (pp *PipePool) Put(r *PipeReader, w *PipeWriter) {
+	r.Close()
+	w.Close()
+	if r.p == w.p && r.p.reset() == nil {
+		pp.pool.Put(r.p)
+	}
+}
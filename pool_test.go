@@ -0,0 +1,69 @@
+package pipebuf_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestReset(t *testing.T) {
+	r, w := pipebuf.Pipe(4, pipebuf.WithHistory(2))
+
+	mustWrite(t, w, []byte("abcd"))
+	mustRead(t, r, []byte("ab"))
+	r.Mark()
+
+	expectError(t, r.Reset(), pipebuf.ErrPipeInUse)
+	w.CloseWithError(errors.New("boom"))
+	expectError(t, w.Reset(), pipebuf.ErrPipeInUse)
+	r.Close()
+
+	if err := r.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-r.Closed():
+		t.Fatal("expected reset pipe to be open")
+	default:
+	}
+	if off := r.Offset(); off != 0 {
+		t.Fatalf("expected offset 0, got %d", off)
+	}
+	if d := w.Discarded(); d != 0 {
+		t.Fatalf("expected nothing discarded, got %d", d)
+	}
+
+	mustWrite(t, w, []byte("efgh"))
+	mustRead(t, r, []byte("ef"))
+	if err := r.RewindToMark(); err != nil {
+		t.Fatalf("expected mark at start of stream, got %v", err)
+	}
+	mustRead(t, r, []byte("efgh"))
+	w.Close()
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestPipePool(t *testing.T) {
+	pool := pipebuf.NewPipePool(8)
+
+	for i := range 3 {
+		r, w := pool.Get()
+		mustWrite(t, w, []byte("hello"))
+		mustRead(t, r, []byte("he"))
+		if off := r.Offset(); off != 2 {
+			t.Fatalf("round %d: expected offset 2, got %d", i, off)
+		}
+		pool.Put(r, w)
+	}
+
+	// Halves of different pipes are closed but not pooled.
+	r1, _ := pool.Get()
+	_, w2 := pool.Get()
+	pool.Put(r1, w2)
+	_, err := r1.Read(make([]byte, 1))
+	expectError(t, err, io.ErrClosedPipe)
+}
@@ -0,0 +1,16 @@
+package pipebuf
+
+import "io"
+
+// NewReadAhead starts a goroutine that reads from src ahead of demand into a
+// buffer of size bytes, and returns the reader side. Reads return src's data,
+// then src's error, or io.EOF once src is exhausted. Closing the returned
+// reader stops the prefetcher once its current src.Read returns.
+func NewReadAhead(src io.Reader, size int) *PipeReader {
+	r, w := Pipe(size)
+	go func() {
+		_, err := w.ReadFrom(src)
+		w.CloseWithError(err)
+	}()
+	return r
+}
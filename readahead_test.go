@@ -0,0 +1,73 @@
+package pipebuf_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestReadAhead(t *testing.T) {
+	testData := bytes.Repeat([]byte("prefetched "), 1000)
+
+	r := pipebuf.NewReadAhead(bytes.NewReader(testData), 64)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(got, testData) {
+		t.Fatalf("data integrity check failed")
+	}
+}
+
+func TestReadAheadError(t *testing.T) {
+	srcErr := errors.New("read failed")
+	r := pipebuf.NewReadAhead(io.MultiReader(bytes.NewReader([]byte("data")), &failingReader{err: srcErr}), 64)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	expectError(t, err, srcErr)
+	if string(got) != "data" {
+		t.Fatalf("expected %q before the error, got %q", "data", got)
+	}
+}
+
+func TestReadAheadClose(t *testing.T) {
+	src := &countingReader{}
+	r := pipebuf.NewReadAhead(src, 8)
+
+	mustRead(t, r, []byte{0})
+	r.Close()
+
+	time.Sleep(10 * time.Millisecond)
+	reads := src.reads.Load()
+	time.Sleep(10 * time.Millisecond)
+	if src.reads.Load() != reads {
+		t.Fatal("prefetcher kept reading after Close")
+	}
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// countingReader is an endless source of zeros that counts Read calls.
+type countingReader struct {
+	reads atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads.Add(1)
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,77 @@
+package pipebuf
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// FlightRecorder is an io.Writer that keeps the most recent bytes written to
+// it. Writes never block and never fail: once full, each write overwrites the
+// oldest data. It is safe for concurrent use.
+type FlightRecorder struct {
+	mu     sync.Mutex
+	buffer *ringBuffer[byte]
+}
+
+var _ io.Writer = (*FlightRecorder)(nil)
+
+// NewFlightRecorder returns a FlightRecorder that retains the last size bytes.
+func NewFlightRecorder(size int) *FlightRecorder {
+	if size <= 0 {
+		size = 1
+	}
+	// One byte of history keeps the last overwritten byte, which tells
+	// SnapshotAligned whether the oldest record is complete.
+	return &FlightRecorder{buffer: newRingBuffer[byte](size, 1)}
+}
+
+// Write records p, discarding the oldest data to make room. It always
+// returns len(p), nil.
+func (f *FlightRecorder) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buffer.overwrite(p)
+	return len(p), nil
+}
+
+// Written returns the total number of bytes ever written to the recorder.
+func (f *FlightRecorder) Written() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return int64(f.buffer.writeOff)
+}
+
+// Snapshot writes the retained bytes, oldest first, to w. Recording continues
+// while w is written to; the snapshot reflects the moment of the call.
+func (f *FlightRecorder) Snapshot(w io.Writer) (int64, error) {
+	return f.snapshot(w, -1)
+}
+
+// SnapshotAligned is like Snapshot but starts at a record boundary: if the
+// oldest retained record was partly overwritten, the bytes up to and
+// including the first delim are left out. The last record is written even if
+// it is incomplete.
+func (f *FlightRecorder) SnapshotAligned(w io.Writer, delim byte) (int64, error) {
+	return f.snapshot(w, int(delim))
+}
+
+func (f *FlightRecorder) snapshot(w io.Writer, delim int) (int64, error) {
+	f.mu.Lock()
+	first, second := f.buffer.peek()
+	data := make([]byte, 0, len(first)+len(second))
+	data = append(append(data, first...), second...)
+	truncated := false
+	if delim >= 0 && f.buffer.readOff > 0 {
+		prev, _ := f.buffer.segments(f.buffer.readOff-1, 1)
+		truncated = prev[0] != byte(delim)
+	}
+	f.mu.Unlock()
+
+	if truncated {
+		i := bytes.IndexByte(data, byte(delim))
+		data = data[i+1:]
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
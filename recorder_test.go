@@ -0,0 +1,105 @@
+package pipebuf_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestFlightRecorder(t *testing.T) {
+	f := pipebuf.NewFlightRecorder(8)
+
+	var buf bytes.Buffer
+	if _, err := f.Snapshot(&buf); err != nil || buf.Len() != 0 {
+		t.Fatalf("expected empty snapshot, got %q, %v", buf.String(), err)
+	}
+
+	for _, s := range []string{"abc", "defgh", "ij"} {
+		if n, err := f.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("write %q: %d, %v", s, n, err)
+		}
+	}
+
+	buf.Reset()
+	n, err := f.Snapshot(&buf)
+	if err != nil || n != 8 || buf.String() != "cdefghij" {
+		t.Fatalf("expected %q, got %q (%d), %v", "cdefghij", buf.String(), n, err)
+	}
+	if w := f.Written(); w != 10 {
+		t.Fatalf("expected 10 bytes written, got %d", w)
+	}
+
+	// A write larger than the recorder keeps its tail.
+	f.Write([]byte("0123456789ABCDEF"))
+	buf.Reset()
+	f.Snapshot(&buf)
+	if buf.String() != "89ABCDEF" {
+		t.Fatalf("expected %q, got %q", "89ABCDEF", buf.String())
+	}
+}
+
+func TestFlightRecorderSnapshotAligned(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "nothing dropped", writes: []string{"one\n", "two"}, want: "one\ntwo"},
+		{name: "partial record dropped", writes: []string{"first\n", "second\n", "third"}, want: "third"},
+		{name: "whole record dropped", writes: []string{"aaaa\n", "bbb\n", "cccc\n"}, want: "bbb\ncccc\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := pipebuf.NewFlightRecorder(10)
+			for _, s := range tt.writes {
+				f.Write([]byte(s))
+			}
+			var buf bytes.Buffer
+			if _, err := f.SnapshotAligned(&buf, '\n'); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestFlightRecorderConcurrent(t *testing.T) {
+	f := pipebuf.NewFlightRecorder(64)
+	line := strings.Repeat("x", 7) + "\n"
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				f.Write([]byte(line))
+			}
+		}()
+	}
+	for range 100 {
+		var buf bytes.Buffer
+		f.SnapshotAligned(&buf, '\n')
+		if buf.Len()%len(line) != 0 || strings.Trim(buf.String(), line) != "" {
+			t.Fatalf("snapshot not aligned to lines: %q", buf.String())
+		}
+	}
+	wg.Wait()
+}
+
+func TestFlightRecorderInvalidSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		f := pipebuf.NewFlightRecorder(size)
+		f.Write([]byte("xy"))
+		var buf bytes.Buffer
+		f.Snapshot(&buf)
+		if buf.String() != "y" {
+			t.Fatalf("size %d: expected %q, got %q", size, "y", buf.String())
+		}
+	}
+}
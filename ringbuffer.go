@@ -1,91 +1,164 @@
 package pipebuf
 
 // ringBuffer implements a single-producer, single-consumer ring buffer.
-type ringBuffer struct {
-	data     []byte
-	readPos  int
-	writePos int
+// Offsets count elements from the start of the stream and only grow;
+// an element lives at its offset modulo len(data).
+type ringBuffer[T any] struct {
+	data []T
+
+	// size is the number of unread elements the buffer holds when full.
+	size int
+	// history is the number of consumed elements kept behind readOff.
+	history int
+
+	histOff  uint64 // oldest retained element
+	readOff  uint64 // next element to read
+	writeOff uint64 // next element to write
+
+	// zero clears elements once they are no longer retained, so values
+	// they reference can be collected. Bytes reference nothing and are left.
+	zero bool
 }
 
-// newRingBuffer creates a new ring buffer with the specified size.
-// The actual buffer is size+1 to distinguish between full and empty states.
-func newRingBuffer(size int) *ringBuffer {
-	return &ringBuffer{
-		data: make([]byte, size+1),
+// newRingBuffer creates a new ring buffer with room for size unread elements
+// plus history already consumed ones.
+func newRingBuffer[T any](size, history int) *ringBuffer[T] {
+	_, isByte := any(*new(T)).(byte)
+	return &ringBuffer[T]{
+		data:    make([]T, size+history),
+		size:    size,
+		history: history,
+		zero:    !isByte,
 	}
 }
 
-// read reads data from the ring buffer into dst and returns the number of bytes read.
-func (r *ringBuffer) read(dst []byte) int {
-	bufLen := len(r.data)
-
-	var available int
-	if r.writePos >= r.readPos {
-		available = r.writePos - r.readPos
-	} else {
-		available = (bufLen - r.readPos) + r.writePos
-	}
-
-	toRead := min(available, len(dst))
-	if toRead == 0 {
-		return 0
+// segments returns the n elements starting at offset off as up to two
+// contiguous slices of data, in order.
+func (r *ringBuffer[T]) segments(off uint64, n int) (first, second []T) {
+	pos := int(off % uint64(len(r.data)))
+	if pos+n <= len(r.data) {
+		return r.data[pos : pos+n], nil
 	}
+	return r.data[pos:], r.data[:n-(len(r.data)-pos)]
+}
 
-	if r.readPos+toRead <= bufLen {
-		copy(dst[:toRead], r.data[r.readPos:r.readPos+toRead])
-		r.readPos = (r.readPos + toRead) % bufLen
-	} else {
-		firstChunk := bufLen - r.readPos
-		secondChunk := toRead - firstChunk
+// read reads data from the ring buffer into dst and returns the number of elements read.
+func (r *ringBuffer[T]) read(dst []T) int {
+	first, second := r.segments(r.readOff, min(len(dst), r.len()))
+	n := copy(dst, first)
+	n += copy(dst[n:], second)
+	r.skip(n)
+	return n
+}
 
-		copy(dst[:firstChunk], r.data[r.readPos:])
-		copy(dst[firstChunk:toRead], r.data[:secondChunk])
+// write writes data from src into the ring buffer and returns the number of elements written.
+func (r *ringBuffer[T]) write(src []T) int {
+	first, second := r.segments(r.writeOff, min(len(src), r.free()))
+	n := copy(first, src)
+	n += copy(second, src[n:])
+	r.commit(n)
+	return n
+}
 
-		r.readPos = secondChunk
+// overwrite writes src, consuming the oldest unread elements to make room.
+// If src is longer than size only its last size elements remain unread.
+func (r *ringBuffer[T]) overwrite(src []T) {
+	for len(src) > 0 {
+		n := min(len(src), r.size)
+		if over := n - r.free(); over > 0 {
+			r.skip(over)
+		}
+		src = src[r.write(src[:n]):]
 	}
+}
 
-	return toRead
+// peek returns the unread elements as up to two contiguous segments, in order,
+// without consuming them.
+func (r *ringBuffer[T]) peek() (first, second []T) {
+	return r.segments(r.readOff, r.len())
+}
+
+// skip consumes the n oldest unread elements; n must not exceed len.
+// Consumed elements stay retained up to the history limit.
+func (r *ringBuffer[T]) skip(n int) {
+	r.readOff += uint64(n)
+	if r.readOff-r.histOff > uint64(r.history) {
+		r.release(r.readOff - uint64(r.history))
+	}
 }
 
-// write writes data from src into the ring buffer and returns the number of bytes written.
-func (r *ringBuffer) write(src []byte) int {
-	bufLen := len(r.data)
+// release drops the retained elements before offset off.
+func (r *ringBuffer[T]) release(off uint64) {
+	if r.zero {
+		first, second := r.segments(r.histOff, int(off-r.histOff))
+		clear(first)
+		clear(second)
+	}
+	r.histOff = off
+}
 
-	var available int
-	if r.writePos >= r.readPos {
-		used := r.writePos - r.readPos
-		available = bufLen - used - 1
-	} else {
-		available = r.readPos - r.writePos - 1
+// rewind moves the read offset back by n retained elements so they are read
+// again. It reports false, leaving the buffer unchanged, if fewer than n
+// consumed elements are retained.
+func (r *ringBuffer[T]) rewind(n int) bool {
+	if n < 0 || uint64(n) > r.readOff-r.histOff {
+		return false
 	}
+	r.readOff -= uint64(n)
+	return true
+}
 
-	toWrite := min(available, len(src))
-	if toWrite == 0 {
-		return 0
+// resize reallocates the buffer to hold size unread elements, keeping the
+// unread and retained elements at their offsets. size must not be less than
+// the number of elements held. Slices returned earlier keep the old contents.
+func (r *ringBuffer[T]) resize(size int) {
+	first, second := r.segments(r.histOff, int(r.writeOff-r.histOff))
+	r.data = make([]T, size+r.history)
+	r.size = size
+	off := r.histOff
+	for _, seg := range [][]T{first, second} {
+		dst1, dst2 := r.segments(off, len(seg))
+		n := copy(dst1, seg)
+		copy(dst2, seg[n:])
+		off += uint64(len(seg))
 	}
+}
+
+// reserve returns the free space as up to two contiguous segments, in order.
+// Elements written into them become readable once they are committed.
+func (r *ringBuffer[T]) reserve() (first, second []T) {
+	return r.segments(r.writeOff, r.free())
+}
 
-	if r.writePos+toWrite < bufLen {
-		copy(r.data[r.writePos:r.writePos+toWrite], src[:toWrite])
-		r.writePos = (r.writePos + toWrite) % bufLen
-	} else {
-		firstChunk := bufLen - r.writePos
-		secondChunk := toWrite - firstChunk
+// commit makes the first n elements of the reserved space readable;
+// n must not exceed free.
+func (r *ringBuffer[T]) commit(n int) {
+	r.writeOff += uint64(n)
+}
 
-		copy(r.data[r.writePos:], src[:firstChunk])
-		copy(r.data[:secondChunk], src[firstChunk:toWrite])
+// len returns the number of unread elements in the ring buffer.
+func (r *ringBuffer[T]) len() int {
+	return int(r.writeOff - r.readOff)
+}
 
-		r.writePos = secondChunk
-	}
+// free returns the number of elements that can be written without overwriting
+// unread or retained data. It is zero while rewound data exceeds size.
+func (r *ringBuffer[T]) free() int {
+	return max(r.size-r.len(), 0)
+}
 
-	return toWrite
+// reset discards all unread and retained elements.
+func (r *ringBuffer[T]) reset() {
+	r.release(r.writeOff)
+	r.readOff = r.writeOff
 }
 
 // empty returns true if the ring buffer is empty.
-func (r *ringBuffer) empty() bool {
-	return r.readPos == r.writePos
+func (r *ringBuffer[T]) empty() bool {
+	return r.readOff == r.writeOff
 }
 
 // full returns true if the ring buffer is full.
-func (r *ringBuffer) full() bool {
-	return (r.writePos+1)%len(r.data) == r.readPos
+func (r *ringBuffer[T]) full() bool {
+	return r.free() == 0
 }
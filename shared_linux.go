@@ -0,0 +1,386 @@
+package pipebuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Layout of a shared pipe file. The indices are monotonic byte counts; each
+// futex word is a sequence number bumped whenever the other side may proceed.
+const (
+	sharedMagic = 0x7069706562756631 // "pipebuf1"
+
+	offMagic          = 0
+	offSize           = 8
+	offWrite          = 64
+	offRead           = 128
+	offState          = 192
+	offDataSeq        = 196
+	offSpaceSeq       = 200
+	offReaderWaiting  = 204
+	offWriterWaiting  = 208
+	offReaderLock     = 212
+	offWriterLock     = 216
+	offWriterCause    = 256
+	offReaderCause    = 512
+	sharedCauseMax    = 256 - 4
+	sharedHeaderSize  = 1024
+	sharedReaderClose = 1 << 0
+	sharedWriterClose = 1 << 1
+	sharedReaderOpen  = 1 << 2
+	sharedWriterOpen  = 1 << 3
+
+	futexWait = 0
+	futexWake = 1
+
+	// Open file description locks, which belong to an open file rather
+	// than a process and are dropped when the last descriptor is closed.
+	fOFDGetlk = 36
+	fOFDSetlk = 37
+
+	// livenessInterval is how often a blocked side checks that its peer
+	// still holds its half open.
+	livenessInterval = 100 * time.Millisecond
+)
+
+// ErrInvalidSharedPipe is returned when opening a file that was not created by NewSharedPipe.
+var ErrInvalidSharedPipe = errors.New("pipebuf: invalid shared pipe file")
+
+// NewSharedPipe creates a pipe whose ring buffer and indices live in a
+// memory-mapped file, so a writer and a reader in different processes on the
+// same host can share it. The file is unlinked on creation; pass it to the
+// other process, for example through exec.Cmd.ExtraFiles, and open each half
+// with OpenSharedReader or OpenSharedWriter.
+//
+// A shared pipe has a single reader and a single writer. Errors passed to
+// CloseWithError cross the process boundary as text. If the process holding
+// one half exits without closing it, the other side notices within a fraction
+// of a second and treats that half as closed, as with a kernel pipe: the
+// reader gets io.EOF once it has drained the buffer, and the writer gets a
+// ClosedError. Each open half holds a lock on its own reopened copy of the
+// file, which the kernel drops when the process exits, so this works across
+// PID namespaces. A half that was never opened, or opened where /proc is not
+// mounted, is not watched.
+func NewSharedPipe(size int) (*os.File, error) {
+	if size <= 0 {
+		size = 1
+	}
+	dir := "/dev/shm"
+	if _, err := os.Stat(dir); err != nil {
+		dir = os.TempDir()
+	}
+	f, err := os.CreateTemp(dir, "pipebuf-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(int64(sharedHeaderSize + size)); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var header [16]byte
+	binary.NativeEndian.PutUint64(header[offSize:], uint64(size))
+	binary.NativeEndian.PutUint64(header[offMagic:], sharedMagic)
+	if _, err := f.WriteAt(header[:], 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// sharedPipe is one process's mapping of a shared pipe file.
+type sharedPipe struct {
+	// closeMu serialises Close calls, which unmap mem; mu guards mem
+	// against concurrent reads or writes through the same handle.
+	closeMu sync.Mutex
+	mu      sync.Mutex
+
+	mem  []byte
+	data []byte
+	size uint64
+
+	// closeErr is the cause this handle was closed with, kept once mem is gone.
+	closeErr error
+
+	// lock is this handle's own open file description of the shared file.
+	// It holds the lock that tells the peer this half is open, and is used
+	// to test the peer's lock. It is nil if the file could not be reopened.
+	lock *os.File
+}
+
+func openShared(f *os.File, lockOff int, openFlag uint32) (*sharedPipe, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < sharedHeaderSize {
+		return nil, ErrInvalidSharedPipe
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("pipebuf: mmap: %w", err)
+	}
+	s := &sharedPipe{mem: mem}
+	s.size = s.u64(offSize).Load()
+	if s.u64(offMagic).Load() != sharedMagic || s.size == 0 || uint64(len(mem)) != sharedHeaderSize+s.size {
+		syscall.Munmap(mem)
+		return nil, ErrInvalidSharedPipe
+	}
+	s.data = mem[sharedHeaderSize:]
+
+	// A descriptor shared with the peer, as f usually is, would share its
+	// locks too, so the lock is taken on a fresh open of the same file.
+	lock, err := os.OpenFile(fmt.Sprintf("/proc/self/fd/%d", f.Fd()), os.O_RDWR, 0)
+	if err == nil {
+		if err := ofdLock(lock, fOFDSetlk, syscall.F_WRLCK, lockOff); err != nil {
+			lock.Close()
+		} else {
+			s.lock = lock
+			s.u32(offState).Or(openFlag)
+		}
+	}
+	return s, nil
+}
+
+func ofdLock(f *os.File, cmd int, typ int16, off int) error {
+	lk := syscall.Flock_t{Type: typ, Start: int64(off), Len: 1}
+	return syscall.FcntlFlock(f.Fd(), cmd, &lk)
+}
+
+// peerGone reports whether the peer opened its half, whose lock is at
+// lockOff, and has since exited without closing it.
+func (s *sharedPipe) peerGone(lockOff int, openFlag uint32) bool {
+	if s.lock == nil || s.u32(offState).Load()&openFlag == 0 {
+		return false
+	}
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Start: int64(lockOff), Len: 1}
+	if err := syscall.FcntlFlock(s.lock.Fd(), fOFDGetlk, &lk); err != nil {
+		return false
+	}
+	return lk.Type == syscall.F_UNLCK
+}
+
+func (s *sharedPipe) u64(off int) *atomic.Uint64 {
+	return (*atomic.Uint64)(unsafe.Pointer(&s.mem[off]))
+}
+
+func (s *sharedPipe) u32(off int) *atomic.Uint32 {
+	return (*atomic.Uint32)(unsafe.Pointer(&s.mem[off]))
+}
+
+// cause returns the error stored at off by CloseWithError, or nil.
+func (s *sharedPipe) cause(off int) error {
+	// The peer may have written anything here.
+	n := min(s.u32(off).Load(), sharedCauseMax)
+	if n == 0 {
+		return nil
+	}
+	return errors.New(string(s.mem[off+4 : off+4+int(n)]))
+}
+
+// wait sleeps on the futex at seqOff until its value moves past seq.
+// The waiting flag tells the other side to issue a wake-up. If the sleep
+// times out and the peer, whose lock is at peerLockOff, no longer holds its
+// half open, that half is marked closed with peerClose.
+func (s *sharedPipe) wait(seqOff, waitingOff int, seq uint32, peerLockOff int, peerOpen, peerClose uint32) {
+	s.u32(waitingOff).Store(1)
+	if s.u32(seqOff).Load() == seq {
+		timeout := syscall.NsecToTimespec(int64(livenessInterval))
+		_, _, errno := syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(&s.mem[seqOff])), futexWait, uintptr(seq), uintptr(unsafe.Pointer(&timeout)), 0, 0)
+		if errno == syscall.ETIMEDOUT && s.peerGone(peerLockOff, peerOpen) {
+			s.u32(offState).Or(peerClose)
+		}
+	}
+	s.u32(waitingOff).Store(0)
+}
+
+// signal bumps the futex at seqOff and wakes the other side if it is waiting.
+func (s *sharedPipe) signal(seqOff, waitingOff int) {
+	s.u32(seqOff).Add(1)
+	if s.u32(waitingOff).Load() != 0 {
+		syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(&s.mem[seqOff])), futexWake, 1, 0, 0, 0)
+	}
+}
+
+// close marks this side closed, records err for the other side, wakes
+// everyone and unmaps the file.
+func (s *sharedPipe) close(flag uint32, causeOff int, err error) error {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+	if s.closeErr != nil {
+		return nil
+	}
+	s.closeErr = io.ErrClosedPipe
+	if err != nil {
+		s.closeErr = err
+	}
+
+	if s.u32(offState).Load()&flag == 0 {
+		if err != nil {
+			msg := err.Error()
+			n := copy(s.mem[causeOff+4:causeOff+4+sharedCauseMax], msg)
+			s.u32(causeOff).Store(uint32(n))
+		}
+		s.u32(offState).Or(flag)
+	}
+	for _, off := range []int{offDataSeq, offSpaceSeq} {
+		s.u32(off).Add(1)
+		syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(&s.mem[off])), futexWake, 1<<30, 0, 0, 0)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mem := s.mem
+	s.mem, s.data = nil, nil
+	unmapErr := syscall.Munmap(mem)
+	if s.lock != nil {
+		s.lock.Close()
+	}
+	return unmapErr
+}
+
+// SharedReader is the read half of a shared pipe.
+type SharedReader struct {
+	s *sharedPipe
+}
+
+// OpenSharedReader maps a file created by NewSharedPipe and returns its read half.
+func OpenSharedReader(f *os.File) (*SharedReader, error) {
+	s, err := openShared(f, offReaderLock, sharedReaderOpen)
+	if err != nil {
+		return nil, err
+	}
+	return &SharedReader{s}, nil
+}
+
+// Read implements io.Reader.
+func (r *SharedReader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if s.mem == nil {
+			return 0, closedError(s.closeErr, false)
+		}
+		seq := s.u32(offDataSeq).Load()
+		state := s.u32(offState).Load()
+		if state&sharedReaderClose != 0 {
+			return 0, closedError(s.cause(offReaderCause), false)
+		}
+		readOff := s.u64(offRead).Load()
+		writeOff := s.u64(offWrite).Load()
+		if avail := writeOff - readOff; avail > 0 {
+			n := ringCopyOut(b[:min(uint64(len(b)), avail)], s.data, readOff)
+			s.u64(offRead).Store(readOff + uint64(n))
+			s.signal(offSpaceSeq, offWriterWaiting)
+			return n, nil
+		}
+		if state&sharedWriterClose != 0 {
+			if err := s.cause(offWriterCause); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		s.wait(offDataSeq, offReaderWaiting, seq, offWriterLock, sharedWriterOpen, sharedWriterClose)
+	}
+}
+
+// Close closes the reader side and unmaps the file.
+func (r *SharedReader) Close() error {
+	return r.s.close(sharedReaderClose, offReaderCause, nil)
+}
+
+// CloseWithError closes the reader side with an error, which future writes
+// in the writer process receive as text wrapped in a ClosedError.
+func (r *SharedReader) CloseWithError(err error) error {
+	return r.s.close(sharedReaderClose, offReaderCause, err)
+}
+
+// SharedWriter is the write half of a shared pipe.
+type SharedWriter struct {
+	s *sharedPipe
+}
+
+// OpenSharedWriter maps a file created by NewSharedPipe and returns its write half.
+func OpenSharedWriter(f *os.File) (*SharedWriter, error) {
+	s, err := openShared(f, offWriterLock, sharedWriterOpen)
+	if err != nil {
+		return nil, err
+	}
+	return &SharedWriter{s}, nil
+}
+
+// Write implements io.Writer.
+func (w *SharedWriter) Write(b []byte) (n int, err error) {
+	s := w.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(b) > 0 {
+		if s.mem == nil {
+			return n, closedError(s.closeErr, false)
+		}
+		seq := s.u32(offSpaceSeq).Load()
+		state := s.u32(offState).Load()
+		if state&sharedWriterClose != 0 {
+			return n, closedError(s.cause(offWriterCause), false)
+		}
+		if state&sharedReaderClose != 0 {
+			return n, closedError(s.cause(offReaderCause), true)
+		}
+		writeOff := s.u64(offWrite).Load()
+		readOff := s.u64(offRead).Load()
+		free := s.size - (writeOff - readOff)
+		if free == 0 {
+			s.wait(offSpaceSeq, offWriterWaiting, seq, offReaderLock, sharedReaderOpen, sharedReaderClose)
+			continue
+		}
+		wrote := ringCopyIn(s.data, writeOff, b[:min(uint64(len(b)), free)])
+		s.u64(offWrite).Store(writeOff + uint64(wrote))
+		s.signal(offDataSeq, offReaderWaiting)
+		b = b[wrote:]
+		n += wrote
+	}
+	return n, nil
+}
+
+// Close closes the writer side and unmaps the file.
+func (w *SharedWriter) Close() error {
+	return w.s.close(sharedWriterClose, offWriterCause, nil)
+}
+
+// CloseWithError closes the writer side with an error, which the reader
+// process receives as text once it has drained the buffer.
+func (w *SharedWriter) CloseWithError(err error) error {
+	return w.s.close(sharedWriterClose, offWriterCause, err)
+}
+
+// ringCopyOut copies len(dst) bytes starting at stream offset off out of ring.
+func ringCopyOut(dst, ring []byte, off uint64) int {
+	pos := int(off % uint64(len(ring)))
+	n := copy(dst, ring[pos:])
+	n += copy(dst[n:], ring)
+	return n
+}
+
+// ringCopyIn copies src into ring starting at stream offset off.
+func ringCopyIn(ring []byte, off uint64, src []byte) int {
+	pos := int(off % uint64(len(ring)))
+	n := copy(ring[pos:], src)
+	n += copy(ring, src[n:])
+	return n
+}
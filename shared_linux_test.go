@@ -0,0 +1,242 @@
+package pipebuf_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestSharedPipe(t *testing.T) {
+	f, err := pipebuf.NewSharedPipe(97)
+	if err != nil {
+		t.Fatalf("NewSharedPipe failed: %v", err)
+	}
+	defer f.Close()
+
+	r, err := pipebuf.OpenSharedReader(f)
+	if err != nil {
+		t.Fatalf("OpenSharedReader failed: %v", err)
+	}
+	defer r.Close()
+	w, err := pipebuf.OpenSharedWriter(f)
+	if err != nil {
+		t.Fatalf("OpenSharedWriter failed: %v", err)
+	}
+
+	testData := make([]byte, 64*1024)
+	for i := range testData {
+		testData[i] = byte(i % 251)
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer w.Close()
+		if _, err := w.Write(testData); err != nil {
+			t.Errorf("Write failed: %v", err)
+		}
+	})
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	wg.Wait()
+	if !bytes.Equal(got, testData) {
+		t.Fatalf("data integrity check failed")
+	}
+}
+
+func TestSharedPipeCloseWithError(t *testing.T) {
+	f, err := pipebuf.NewSharedPipe(16)
+	if err != nil {
+		t.Fatalf("NewSharedPipe failed: %v", err)
+	}
+	defer f.Close()
+
+	r, _ := pipebuf.OpenSharedReader(f)
+	w, _ := pipebuf.OpenSharedWriter(f)
+
+	r.CloseWithError(errors.New("consumer went away"))
+
+	_, err = w.Write([]byte("data"))
+	var closedErr *pipebuf.ClosedError
+	if !errors.As(err, &closedErr) || !closedErr.Remote {
+		t.Fatalf("expected remote ClosedError, got %v", err)
+	}
+	if closedErr.Err == nil || closedErr.Err.Error() != "consumer went away" {
+		t.Fatalf("expected cause to cross the pipe, got %v", closedErr.Err)
+	}
+	w.Close()
+
+	_, err = r.Read(make([]byte, 1))
+	expectError(t, err, io.ErrClosedPipe)
+}
+
+func TestSharedPipeInvalidFile(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "invalid")
+	if err != nil {
+		t.Fatalf("CreateTemp failed: %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(4096); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+
+	_, err = pipebuf.OpenSharedReader(f)
+	expectError(t, err, pipebuf.ErrInvalidSharedPipe)
+}
+
+func TestSharedPipeCrossProcess(t *testing.T) {
+	if os.Getenv("PIPEBUF_SHARED_WRITER") == "1" {
+		w, err := pipebuf.OpenSharedWriter(os.NewFile(3, "shared"))
+		if err != nil {
+			os.Exit(2)
+		}
+		for range 1000 {
+			if _, err := io.WriteString(w, "hello from the child\n"); err != nil {
+				os.Exit(3)
+			}
+		}
+		w.CloseWithError(errors.New("child done"))
+		os.Exit(0)
+	}
+
+	f, err := pipebuf.NewSharedPipe(64)
+	if err != nil {
+		t.Fatalf("NewSharedPipe failed: %v", err)
+	}
+	defer f.Close()
+	r, err := pipebuf.OpenSharedReader(f)
+	if err != nil {
+		t.Fatalf("OpenSharedReader failed: %v", err)
+	}
+	defer r.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSharedPipeCrossProcess$")
+	cmd.Env = append(os.Environ(), "PIPEBUF_SHARED_WRITER=1")
+	cmd.ExtraFiles = []*os.File{f}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	got, err := io.ReadAll(r)
+	if err == nil || err.Error() != "child done" {
+		t.Fatalf("expected the child's close error, got %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child failed: %v", err)
+	}
+	want := bytes.Repeat([]byte("hello from the child\n"), 1000)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("data integrity check failed: got %d bytes", len(got))
+	}
+}
+
+func TestSharedPipeWriterExits(t *testing.T) {
+	if os.Getenv("PIPEBUF_SHARED_WRITER") == "exit" {
+		w, err := pipebuf.OpenSharedWriter(os.NewFile(3, "shared"))
+		if err != nil {
+			os.Exit(2)
+		}
+		io.WriteString(w, "partial")
+		os.Exit(0) // without closing w
+	}
+
+	f, err := pipebuf.NewSharedPipe(64)
+	if err != nil {
+		t.Fatalf("NewSharedPipe failed: %v", err)
+	}
+	defer f.Close()
+	r, err := pipebuf.OpenSharedReader(f)
+	if err != nil {
+		t.Fatalf("OpenSharedReader failed: %v", err)
+	}
+	defer r.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSharedPipeWriterExits$")
+	cmd.Env = append(os.Environ(), "PIPEBUF_SHARED_WRITER=exit")
+	cmd.ExtraFiles = []*os.File{f}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	f.Close()
+
+	// The child is not reaped until ReadAll returns, so it must be seen as
+	// gone while still a zombie.
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected EOF after the writer exited, got %v", err)
+	}
+	if string(got) != "partial" {
+		t.Fatalf("expected %q, got %q", "partial", got)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child failed: %v", err)
+	}
+}
+
+func TestSharedPipeIdleWriterInPIDNamespace(t *testing.T) {
+	if os.Getenv("PIPEBUF_SHARED_READER") == "1" {
+		r, err := pipebuf.OpenSharedReader(os.NewFile(3, "shared"))
+		if err != nil {
+			os.Exit(2)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || string(got) != "first second" {
+			os.Stderr.WriteString("read " + string(got) + "\n")
+			os.Exit(3)
+		}
+		os.Exit(0)
+	}
+
+	f, err := pipebuf.NewSharedPipe(64)
+	if err != nil {
+		t.Fatalf("NewSharedPipe failed: %v", err)
+	}
+	defer f.Close()
+	w, err := pipebuf.OpenSharedWriter(f)
+	if err != nil {
+		t.Fatalf("OpenSharedWriter failed: %v", err)
+	}
+
+	// The reader runs in its own PID namespace, as a sidecar would, where
+	// this process's pid means nothing.
+	newCmd := func() *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestSharedPipeIdleWriterInPIDNamespace$")
+		cmd.Env = append(os.Environ(), "PIPEBUF_SHARED_READER=1")
+		cmd.ExtraFiles = []*os.File{f}
+		cmd.Stderr = os.Stderr
+		return cmd
+	}
+	cmd := newCmd()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWPID}
+	if err := cmd.Start(); err != nil {
+		t.Logf("no PID namespace (%v), running the reader in this one", err)
+		cmd = newCmd()
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+	}
+
+	if _, err := io.WriteString(w, "first "); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	// Stay idle for several liveness checks by the blocked reader.
+	time.Sleep(500 * time.Millisecond)
+	if _, err := io.WriteString(w, "second"); err != nil {
+		t.Fatalf("Write after idling failed: %v", err)
+	}
+	w.Close()
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("reader failed: %v", err)
+	}
+}
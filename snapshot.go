@@ -0,0 +1,148 @@
+package pipebuf
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrInvalidSnapshot is returned when decoding a malformed Snapshot.
+var ErrInvalidSnapshot = errors.New("pipebuf: invalid snapshot")
+
+const snapshotVersion = 1
+
+// Snapshot holds the in-flight contents of a pipe, taken out with
+// PipeReader.Snapshot, so they can be carried over to a new pipe with
+// PipeFromSnapshot, possibly in another process.
+type Snapshot struct {
+	// Data holds the bytes that had not been read yet.
+	Data []byte
+	// Offset is the stream offset of the first byte of Data.
+	Offset int64
+	// WriterClosed reports whether the writer had closed the pipe.
+	WriterClosed bool
+	// Cause is the message of the error the writer passed to
+	// CloseWithError, or empty.
+	Cause string
+}
+
+var (
+	_ encoding.BinaryMarshaler   = (*Snapshot)(nil)
+	_ encoding.BinaryUnmarshaler = (*Snapshot)(nil)
+)
+
+// Snapshot atomically takes the unread bytes out of the pipe, together with
+// the read offset and whether the writer has closed. The bytes are consumed:
+// the pipe stays open and later writes are read as usual.
+func (r *PipeReader) Snapshot() (*Snapshot, error) {
+	p := r.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waitReaderTurnLocked()
+	defer p.doneReaderTurnLocked()
+	if p.readerClosed {
+		return nil, closedError(p.writerClosedErr, false)
+	}
+
+	wasFull := p.buffer.full()
+	first, second := p.buffer.peek()
+	s := &Snapshot{
+		Data:         append(append(make([]byte, 0, len(first)+len(second)), first...), second...),
+		Offset:       int64(p.buffer.readOff),
+		WriterClosed: p.writerClosed,
+	}
+	if p.readerClosedErr != nil && p.readerClosedErr != io.EOF {
+		s.Cause = p.readerClosedErr.Error()
+	}
+	p.buffer.skip(len(s.Data))
+	p.readDoneLocked(wasFull)
+	return s, nil
+}
+
+// PipeFromSnapshot creates a pipe like Pipe whose buffer is pre-filled with
+// the data in s, continuing its stream offsets. The buffer size, and the
+// WithBudget minimum, are raised to hold all of s.Data. If the writer of the
+// original pipe had closed, the writer of the new pipe is closed with the
+// same cause, so the reader sees the remaining data followed by the same end
+// of stream.
+func PipeFromSnapshot(s *Snapshot, bufferSize int, opts ...Option) (*PipeReader, *PipeWriter) {
+	r, w := Pipe(max(bufferSize, len(s.Data)), opts...)
+	p := r.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	off := uint64(max(s.Offset, 0))
+	p.buffer.histOff, p.buffer.readOff, p.buffer.writeOff = off, off, off
+	p.mark = off
+	if p.buffer.size < len(s.Data) {
+		p.minSize = len(s.Data)
+		p.buffer.resize(p.minSize)
+	}
+	p.buffer.write(s.Data)
+	if s.WriterClosed {
+		var cause error
+		if s.Cause != "" {
+			cause = errors.New(s.Cause)
+		}
+		p.closeWriterLocked(cause, true)
+	}
+	return r, w
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *Snapshot) MarshalBinary() ([]byte, error) {
+	var flags byte
+	if s.WriterClosed {
+		flags |= 1
+	}
+	b := make([]byte, 0, 2+3*binary.MaxVarintLen64+len(s.Cause)+len(s.Data))
+	b = append(b, snapshotVersion, flags)
+	b = binary.AppendUvarint(b, uint64(s.Offset))
+	b = binary.AppendUvarint(b, uint64(len(s.Cause)))
+	b = append(b, s.Cause...)
+	b = binary.AppendUvarint(b, uint64(len(s.Data)))
+	return append(b, s.Data...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *Snapshot) UnmarshalBinary(b []byte) error {
+	if len(b) < 2 || b[0] != snapshotVersion || b[1]&^1 != 0 {
+		return ErrInvalidSnapshot
+	}
+	writerClosed := b[1]&1 != 0
+	b = b[2:]
+
+	offset, n := binary.Uvarint(b)
+	if n <= 0 || offset > 1<<63-1 {
+		return ErrInvalidSnapshot
+	}
+	b = b[n:]
+
+	cause, b, ok := uvarintBytes(b)
+	if !ok {
+		return ErrInvalidSnapshot
+	}
+	data, b, ok := uvarintBytes(b)
+	if !ok || len(b) != 0 {
+		return ErrInvalidSnapshot
+	}
+
+	*s = Snapshot{
+		Data:         append([]byte(nil), data...),
+		Offset:       int64(offset),
+		WriterClosed: writerClosed,
+		Cause:        string(cause),
+	}
+	return nil
+}
+
+// uvarintBytes splits a length-prefixed byte string off the front of b.
+func uvarintBytes(b []byte) (field, rest []byte, ok bool) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || l > uint64(len(b)-n) {
+		return nil, nil, false
+	}
+	b = b[n:]
+	return b[:l], b[l:], true
+}
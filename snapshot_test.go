@@ -0,0 +1,93 @@
+package pipebuf_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	r, w := pipebuf.Pipe(8)
+
+	mustWrite(t, w, []byte("abcdef"))
+	mustRead(t, r, []byte("ab"))
+
+	s, err := r.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(s.Data) != "cdef" || s.Offset != 2 || s.WriterClosed {
+		t.Fatalf("unexpected snapshot %+v", s)
+	}
+
+	// The old pipe no longer holds the data and keeps working.
+	mustWrite(t, w, []byte("gh"))
+	mustRead(t, r, []byte("gh"))
+
+	b, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded pipebuf.Snapshot
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	r2, w2 := pipebuf.PipeFromSnapshot(&decoded, 2)
+	if off := r2.Offset(); off != 2 {
+		t.Fatalf("expected offset 2, got %d", off)
+	}
+	mustRead(t, r2, []byte("cdef"))
+	mustWrite(t, w2, []byte("ij"))
+	w2.Close()
+	mustRead(t, r2, []byte("ij"))
+	if _, err := r2.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestSnapshotWriterClosed(t *testing.T) {
+	cause := errors.New("upstream failed")
+	r, w := pipebuf.Pipe(8)
+	mustWrite(t, w, []byte("abc"))
+	w.CloseWithError(cause)
+
+	s, err := r.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.WriterClosed || s.Cause != cause.Error() {
+		t.Fatalf("unexpected snapshot %+v", s)
+	}
+
+	r2, w2 := pipebuf.PipeFromSnapshot(s, 8)
+	mustRead(t, r2, []byte("abc"))
+	_, err = r2.Read(make([]byte, 1))
+	if err == nil || err.Error() != cause.Error() {
+		t.Fatalf("expected %v, got %v", cause, err)
+	}
+	_, err = w2.Write([]byte("x"))
+	expectError(t, err, io.ErrClosedPipe)
+
+	r.Close()
+	_, err = r.Snapshot()
+	expectError(t, err, io.ErrClosedPipe)
+}
+
+func TestSnapshotUnmarshalInvalid(t *testing.T) {
+	valid, _ := (&pipebuf.Snapshot{Data: []byte("data"), Offset: 7, Cause: "x"}).MarshalBinary()
+	tests := map[string][]byte{
+		"empty":       nil,
+		"version":     append([]byte{9}, valid[1:]...),
+		"truncated":   valid[:len(valid)-1],
+		"extra bytes": append(valid, 0),
+	}
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			var s pipebuf.Snapshot
+			expectError(t, s.UnmarshalBinary(b), pipebuf.ErrInvalidSnapshot)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package pipebuf_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+func TestTransferFile(t *testing.T) {
+	testData := make([]byte, 64*1024+13)
+	for i := range testData {
+		testData[i] = byte(i % 251)
+	}
+
+	osr, osw, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe failed: %v", err)
+	}
+	defer osr.Close()
+
+	r1, w1 := pipebuf.Pipe(1000)
+	r2, w2 := pipebuf.Pipe(777)
+	t.Cleanup(func() {
+		r1.Close()
+		r2.Close()
+	})
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer w1.Close()
+		for i := 0; i < len(testData); i += 333 {
+			mustWrite(t, w1, testData[i:min(i+333, len(testData))])
+		}
+	})
+	wg.Go(func() {
+		defer osw.Close()
+		if _, err := r1.WriteTo(osw); err != nil {
+			t.Errorf("WriteTo failed: %v", err)
+		}
+	})
+	wg.Go(func() {
+		defer w2.Close()
+		if _, err := w2.ReadFrom(osr); err != nil {
+			t.Errorf("ReadFrom failed: %v", err)
+		}
+	})
+
+	got, err := io.ReadAll(r2)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	wg.Wait()
+	if !bytes.Equal(got, testData) {
+		t.Fatalf("data integrity check failed")
+	}
+}
+
+func TestTransferTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	testData := bytes.Repeat([]byte("0123456789abcdef"), 8*1024)
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("Accept failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		r, w := pipebuf.Pipe(1021)
+		defer r.Close()
+		go func() {
+			defer w.Close()
+			mustWrite(t, w, testData)
+		}()
+		if _, err := r.WriteTo(conn); err != nil {
+			t.Errorf("WriteTo failed: %v", err)
+		}
+	})
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	r, w := pipebuf.Pipe(999)
+	defer r.Close()
+	go func() {
+		defer w.Close()
+		if _, err := w.ReadFrom(conn); err != nil {
+			t.Errorf("ReadFrom failed: %v", err)
+		}
+	}()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	wg.Wait()
+	if !bytes.Equal(got, testData) {
+		t.Fatalf("data integrity check failed")
+	}
+}
@@ -0,0 +1,44 @@
+package pipebuf
+
+import "sync"
+
+// turnQueue hands a critical section guarded by a mutex to goroutines in
+// arrival order. Each waiter sleeps on its own cond, so finishing a turn
+// wakes only the next goroutine in line.
+type turnQueue struct {
+	busy    bool
+	waiters []*turnWaiter
+}
+
+type turnWaiter struct {
+	cond  sync.Cond
+	ready bool
+}
+
+// wait blocks until every goroutine that called wait earlier has called done.
+// mu must be held; it is released while waiting.
+func (q *turnQueue) wait(mu *sync.Mutex) {
+	if !q.busy {
+		q.busy = true
+		return
+	}
+	w := &turnWaiter{cond: sync.Cond{L: mu}}
+	q.waiters = append(q.waiters, w)
+	for !w.ready {
+		w.cond.Wait()
+	}
+}
+
+// done ends the current turn and passes it to the next waiter, if any.
+func (q *turnQueue) done() {
+	if len(q.waiters) == 0 {
+		q.busy = false
+		q.waiters = q.waiters[:0]
+		return
+	}
+	w := q.waiters[0]
+	q.waiters[0] = nil
+	q.waiters = q.waiters[1:]
+	w.ready = true
+	w.cond.Signal()
+}
@@ -0,0 +1,77 @@
+package pipebuf
+
+// ValuePipe creates a buffered pipe that carries values of type T instead of bytes.
+// It has the same close semantics as Pipe: closing either side wakes the other,
+// and CloseWithError hands an error to the peer.
+func ValuePipe[T any](bufferSize int) (*ValueReader[T], *ValueWriter[T]) {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	p := newPipe[T](bufferSize, 0)
+	return &ValueReader[T]{p}, &ValueWriter[T]{p}
+}
+
+// ValueReader is the receive half of a value pipe.
+type ValueReader[T any] struct {
+	p *pipe[T]
+}
+
+// Recv receives a single value, blocking until one is available.
+// It returns io.EOF once the writer is closed and all values have been received.
+func (r *ValueReader[T]) Recv() (T, error) {
+	var v [1]T
+	_, err := r.p.Read(v[:])
+	return v[0], err
+}
+
+// RecvN receives up to len(dst) values under a single lock acquisition,
+// blocking until at least one is available.
+func (r *ValueReader[T]) RecvN(dst []T) (int, error) {
+	return r.p.Read(dst)
+}
+
+// Close closes the receive side of the pipe.
+// Any values still buffered are discarded.
+func (r *ValueReader[T]) Close() error {
+	return r.p.Close()
+}
+
+// CloseWithError closes the receive side of the pipe with an error.
+// The error will be wrapped in a ClosedError returned to future sends.
+func (r *ValueReader[T]) CloseWithError(err error) error {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	r.p.closeReaderLocked(err, true)
+	return nil
+}
+
+// ValueWriter is the send half of a value pipe.
+type ValueWriter[T any] struct {
+	p *pipe[T]
+}
+
+// Send sends a single value, blocking until there is room in the buffer.
+func (w *ValueWriter[T]) Send(v T) error {
+	_, err := w.p.Write([]T{v})
+	return err
+}
+
+// SendN sends all values in src, copying as many as fit per lock acquisition.
+// It returns the number of values sent.
+func (w *ValueWriter[T]) SendN(src []T) (int, error) {
+	return w.p.Write(src)
+}
+
+// Close closes the send side of the pipe.
+func (w *ValueWriter[T]) Close() error {
+	return w.p.closeWrite()
+}
+
+// CloseWithError closes the send side of the pipe with an error.
+// The error will be returned to future receives once the buffer is drained.
+func (w *ValueWriter[T]) CloseWithError(err error) error {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	w.p.closeWriterLocked(err, true)
+	return nil
+}
@@ -0,0 +1,156 @@
+package pipebuf_test
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"weak"
+
+	"github.com/jacoelho/pipebuf"
+)
+
+type record struct {
+	id   int
+	name string
+}
+
+func TestValuePipe(t *testing.T) {
+	r, w := pipebuf.ValuePipe[record](2)
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer w.Close()
+		for i := range 10 {
+			if err := w.Send(record{id: i, name: "r"}); err != nil {
+				t.Errorf("Send failed: %v", err)
+				return
+			}
+		}
+	})
+
+	for i := range 10 {
+		v, err := r.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if v.id != i {
+			t.Fatalf("expected id %d, got %d", i, v.id)
+		}
+	}
+
+	_, err := r.Recv()
+	expectError(t, err, io.EOF)
+	wg.Wait()
+}
+
+func TestValuePipeBatch(t *testing.T) {
+	r, w := pipebuf.ValuePipe[int](8)
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+
+	input := make([]int, 100)
+	for i := range input {
+		input[i] = i
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer w.Close()
+		if n, err := w.SendN(input); err != nil || n != len(input) {
+			t.Errorf("SendN returned %d, %v", n, err)
+		}
+	})
+
+	var got []int
+	batch := make([]int, 5)
+	for {
+		n, err := r.RecvN(batch)
+		got = append(got, batch[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("RecvN failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if !slices.Equal(got, input) {
+		t.Fatalf("expected %v, got %v", input, got)
+	}
+}
+
+func TestValuePipeCloseWithError(t *testing.T) {
+	t.Run("Writer", func(t *testing.T) {
+		r, w := pipebuf.ValuePipe[string](4)
+
+		customErr := errors.New("producer failed")
+		if err := w.Send("last"); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		w.CloseWithError(customErr)
+
+		v, err := r.Recv()
+		if err != nil || v != "last" {
+			t.Fatalf("expected buffered value, got %q, %v", v, err)
+		}
+		_, err = r.Recv()
+		expectError(t, err, customErr)
+	})
+
+	t.Run("Reader", func(t *testing.T) {
+		r, w := pipebuf.ValuePipe[string](4)
+
+		customErr := errors.New("consumer failed")
+		r.CloseWithError(customErr)
+
+		err := w.Send("value")
+		expectError(t, err, customErr)
+		expectError(t, err, io.ErrClosedPipe)
+	})
+}
+
+func TestValuePipeReleasesValues(t *testing.T) {
+	r, w := pipebuf.ValuePipe[*[1 << 20]byte](8)
+
+	var received, discarded []weak.Pointer[[1 << 20]byte]
+	for range 8 {
+		v := new([1 << 20]byte)
+		received = append(received, weak.Make(v))
+		if err := w.Send(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := make([]*[1 << 20]byte, 8)
+	if n, err := r.RecvN(dst); n != 8 || err != nil {
+		t.Fatalf("expected 8 values, got %d, %v", n, err)
+	}
+	clear(dst)
+
+	for range 4 {
+		v := new([1 << 20]byte)
+		discarded = append(discarded, weak.Make(v))
+		if err := w.Send(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Close()
+
+	runtime.GC()
+	runtime.GC()
+	for i, p := range append(received, discarded...) {
+		if p.Value() != nil {
+			t.Fatalf("value %d still reachable from the pipe", i)
+		}
+	}
+	runtime.KeepAlive(w)
+}